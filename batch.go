@@ -0,0 +1,152 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package graphquery
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/storyicon/graphquery/kernel"
+)
+
+const (
+	// ErrBatchSkipped means a document of the batch is not parsed
+	ErrBatchSkipped = "document skipped: %s"
+	// ErrBatchFailFast is the reason of the documents skipped after a document failed with FailFast
+	ErrBatchFailFast = "another document failed"
+)
+
+// BatchOptions configures ParseBatch.
+type BatchOptions struct {
+	// Workers is the maximum number of the documents parsed at the same time,
+	// it is runtime.GOMAXPROCS(0) when it is not positive.
+	Workers int
+	// FailFast stops starting the documents left once the response of a document has errors,
+	// the documents being parsed are finished and the ones left are skipped.
+	FailFast bool
+	// Options are applied to the parse of every document, such as kernel.WithLimits.
+	Options []kernel.Option
+}
+
+// BatchResult is the result of a document of the batch.
+type BatchResult struct {
+	// Response is the response of the document, the errors of the document are recorded in its Errors.
+	Response *Response
+	// Skipped reports whether the document is not parsed, the reason is recorded in the Errors of Response.
+	Skipped bool
+	// Duration is the time spent in parsing the document.
+	Duration time.Duration
+}
+
+// Failed reports whether the document is skipped or its response has errors.
+func (result *BatchResult) Failed() bool {
+	return len(result.Response.Errors) > 0
+}
+
+// BatchResponse is the response of ParseBatch.
+type BatchResponse struct {
+	// Results are the results of the documents in the order of the documents.
+	Results []*BatchResult
+	// Failed is the number of the failed documents, including the skipped ones,
+	// Skipped is the number of the skipped documents.
+	Failed, Skipped int
+	// Elapsed is the time spent in parsing the whole batch,
+	// Total and Max are the sum and the maximum of the durations of the documents.
+	Elapsed, Total, Max time.Duration
+}
+
+// ParseBatch parses the documents with the compiled graph by a pool of workers,
+// a compiled graph is never written to while parsing, so the workers share it.
+func ParseBatch(graph *kernel.Graph, documents []string, opts BatchOptions) *BatchResponse {
+	return ParseBatchContext(context.Background(), graph, documents, opts)
+}
+
+// ParseBatchContext is like ParseBatch, but stops parsing when ctx is cancelled or expired,
+// the documents being parsed return the data parsed so far and the ones left are skipped.
+func ParseBatchContext(ctx context.Context, graph *kernel.Graph, documents []string, opts BatchOptions) *BatchResponse {
+	start := time.Now()
+	response := &BatchResponse{
+		Results: make([]*BatchResult, len(documents)),
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(documents) {
+		workers = len(documents)
+	}
+	// dispatch is cancelled when a document fails with FailFast, the documents being parsed are not stopped
+	dispatch, cancel := context.WithCancel(ctx)
+	defer cancel()
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				result := parseDocument(ctx, dispatch, graph, documents[index], opts.Options)
+				if opts.FailFast && !result.Skipped && result.Failed() {
+					cancel()
+				}
+				response.Results[index] = result
+			}
+		}()
+	}
+	for index := range documents {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	for _, result := range response.Results {
+		if result.Failed() {
+			response.Failed++
+		}
+		if result.Skipped {
+			response.Skipped++
+		}
+		response.Total += result.Duration
+		if result.Duration > response.Max {
+			response.Max = result.Duration
+		}
+	}
+	response.Elapsed = time.Since(start)
+	return response
+}
+
+// parseDocument parses the document of the batch, it is skipped when dispatch is done.
+func parseDocument(ctx context.Context, dispatch context.Context, graph *kernel.Graph, document string, options []kernel.Option) *BatchResult {
+	if err := dispatch.Err(); err != nil {
+		reason := ErrBatchFailFast
+		if err = ctx.Err(); err != nil {
+			reason = err.Error()
+		}
+		return &BatchResult{
+			Response: &Response{
+				Errors: kernel.Errors{{Err: fmt.Sprintf(ErrBatchSkipped, reason)}},
+			},
+			Skipped: true,
+		}
+	}
+	start := time.Now()
+	response := graph.ParseContext(ctx, document, options...)
+	return &BatchResult{
+		Response: response,
+		Duration: time.Since(start),
+	}
+}
@@ -18,41 +18,83 @@ import (
 	"fmt"
 
 	"github.com/storyicon/graphquery/kernel"
+	"github.com/storyicon/graphquery/kernel/pipeline"
 )
 
 // Iterator is a io.Reader like object, with specific read functions.
 type Iterator struct {
 	bytes      []byte
 	head, tail int
-	Error      error
+	// eof reports whether the last nextToken reached the end,
+	// in which case there is nothing to unread.
+	eof bool
+	// comments are the comments read but not attached to nodes yet,
+	// commented is the end of the last comment read.
+	comments  []pendingComment
+	commented int
+	// closing are the comments before the closing bracket of the last children read.
+	closing []*kernel.Comment
+	// fragments are the fragment definitions by name, expanding are the names of
+	// the fragments being expanded, spreads are the placeholders of the fragment spreads
+	// and their offsets.
+	fragments map[string]*fragment
+	expanding []string
+	spreads   map[*kernel.GraphNode]int
+	// references are the offsets of the children referred by the filters.
+	references map[*kernel.Predicate]int
+	// listKeys are the offsets of the list operators and the children referred by them.
+	listKeys map[listKey]int
+	// resolver loads the imported files, file is the file being read,
+	// chain is the files imported from the compiled expression to file.
+	resolver Resolver
+	file     string
+	chain    []string
+	// registry provides the processors which the pipelines are checked against.
+	registry *pipeline.Registry
+	// Error is the first error found, Errors contains all of them.
+	Error  error
+	Errors CompileErrors
 }
 
 // ParseBytes creates an Iterator instance from byte array
 func ParseBytes(bytes []byte) *Iterator {
 	return &Iterator{
-		bytes: bytes,
-		head:  0,
-		tail:  len(bytes),
+		bytes:      bytes,
+		head:       0,
+		tail:       len(bytes),
+		fragments:  map[string]*fragment{},
+		spreads:    map[*kernel.GraphNode]int{},
+		references: map[*kernel.Predicate]int{},
+		listKeys:   map[listKey]int{},
 	}
 }
 
-//nextToken used to return the next non-whitespace token
+// nextToken used to return the next token which is neither whitespace nor comment
 func (iter *Iterator) nextToken() byte {
+	prev := iter.head
 	for i := iter.head; i < iter.tail; i++ {
 		// a variation of skip whitespaces
 		c := iter.bytes[i]
 		switch c {
 		case ' ', '\n', '\t', '\r':
 			continue
+		case '/':
+			if end := iter.commentEnd(i); end > i {
+				iter.recordComment(prev, i, end)
+				prev, i = end, end-1
+				continue
+			}
 		}
 		iter.head = i + 1
+		iter.eof = false
 		return c
 	}
+	iter.eof = true
 	return 0
 }
 
 func (iter *Iterator) unreadByte() {
-	if iter.Error != nil {
+	if iter.eof {
 		return
 	}
 	iter.head--
@@ -61,48 +103,69 @@ func (iter *Iterator) unreadByte() {
 
 // ReportError record a error in iterator instance with current position.
 func (iter *Iterator) ReportError(operation string, msg string) {
-	if iter.Error != nil {
-		return
-	}
-	peekStart := iter.head - 10
-	if peekStart < 0 {
-		peekStart = 0
-	}
-	peekEnd := iter.head + 10
-	if peekEnd > iter.tail {
-		peekEnd = iter.tail
-	}
-	parsing := string(iter.bytes[peekStart:peekEnd])
-	contextStart := iter.head - 50
-	if contextStart < 0 {
-		contextStart = 0
-	}
-	contextEnd := iter.head + 50
-	if contextEnd > iter.tail {
-		contextEnd = iter.tail
-	}
-	context := string(iter.bytes[contextStart:contextEnd])
-	iter.Error = fmt.Errorf("%s: %s, error found in #%v byte of ...|%s|..., bigger context ...|%s|... ",
-		operation, msg, iter.head-peekStart, parsing, context)
-	panic(iter.Error)
+	iter.report(newCompileError(iter.bytes[:iter.tail], iter.head, iter.head, operation, msg))
 }
 
 // ReportMismatchChar report an error that does not match the expected character.
 func (iter *Iterator) ReportMismatchChar(operation string, expect byte, appear byte) {
-	iter.ReportError(operation,
-		fmt.Sprintf(`Expect "%s" character, but %s appears.`,
-			string(expect), string(appear),
-		),
-	)
+	iter.reportMismatchAt(operation, iter.tokenOffset(appear), expect, appear)
 }
 
 // ReportUnExpectedChar reports an error of "unexpected character".
 func (iter *Iterator) ReportUnExpectedChar(operation string, appear byte) {
-	iter.ReportError(operation,
-		fmt.Sprintf(`Unexpected character "%s"`,
-			string(appear),
-		),
+	iter.reportUnexpectedAt(operation, iter.tokenOffset(appear), appear)
+}
+
+func (iter *Iterator) reportMismatchAt(operation string, offset int, expect byte, appear byte) {
+	err := newCompileError(iter.bytes[:iter.tail], iter.head, offset, operation, "")
+	err.Expected = string(expect)
+	err.Message = fmt.Sprintf(`Expect "%s" character, but %s appears.`,
+		err.Expected, err.Actual,
 	)
+	iter.report(err)
+}
+
+func (iter *Iterator) reportUnexpectedAt(operation string, offset int, appear byte) {
+	err := newCompileError(iter.bytes[:iter.tail], iter.head, offset, operation, "")
+	err.Message = fmt.Sprintf(`Unexpected character "%s"`, err.Actual)
+	if err.Actual == TokenEOF {
+		err.Message = "Unexpected EOF"
+	}
+	iter.report(err)
+}
+
+func (iter *Iterator) reportAt(operation string, offset int, msg string) {
+	iter.report(newCompileError(iter.bytes[:iter.tail], iter.head, offset, operation, msg))
+}
+
+// recordAt records an error at offset without stopping the reading.
+func (iter *Iterator) recordAt(operation string, offset int, msg string) {
+	iter.record(newCompileError(iter.bytes[:iter.tail], offset, offset, operation, msg))
+}
+
+// tokenOffset returns the offset of the token just read by nextToken.
+func (iter *Iterator) tokenOffset(token byte) int {
+	if token == 0 || iter.head == 0 {
+		return iter.tail
+	}
+	return iter.head - 1
+}
+
+// report records the error and panics,
+// the panic is recovered by ReadNodeRecovered or Read.
+func (iter *Iterator) report(err *CompileError) {
+	iter.record(err)
+	panic(err)
+}
+
+// record records the error, it is ignored when it is the same as the last one.
+func (iter *Iterator) record(err *CompileError) {
+	if iter.Error == nil {
+		iter.Error = err
+	}
+	if last := len(iter.Errors) - 1; last < 0 || !iter.Errors[last].same(err) {
+		iter.Errors = append(iter.Errors, err)
+	}
 }
 
 // WhatIsNext gets ValueType of relatively next element
@@ -125,26 +188,97 @@ func (iter *Iterator) Read() (parser *kernel.Graph) {
 		Root: &kernel.GraphNode{
 			Name: kernel.TypeRootNode,
 		},
+		Registry: iter.registry,
 	}
 
 	defer func() { recover() }()
 
-	valueType := iter.WhatIsNext()
-	switch valueType {
-	case SignalObject:
+	parser.Imports = iter.ReadImports()
+	fragments := iter.ReadFragments()
+	switch {
+	case iter.WhatIsNext() == SignalObject:
 		parser.GraphType = kernel.TypeObjectGraph
+		parser.Root.Comments = iter.takeComments(kernel.CommentLeading)
 		parser.Nodes = iter.ReadObject()
+		parser.Root.Comments = append(parser.Root.Comments, iter.closing...)
+	case iter.WhatIsNextByte() == 0 && len(parser.Imports)+len(fragments) > 0:
+		// an expression of imports and fragments only, such as the files imported by others
+		parser.GraphType = kernel.TypeObjectGraph
 	default:
 		node := iter.ReadNode()
 		parser.GraphType = kernel.TypeAtomGraph
 		parser.Nodes = append(parser.Nodes, node)
 	}
+	// the comments at the end of the expression
+	iter.WhatIsNextByte()
+	parser.Root.Comments = append(parser.Root.Comments, iter.takeComments(kernel.CommentTrailing)...)
+
+	for _, node := range fragments {
+		parser.Fragments = append(parser.Fragments, iter.expandFragment(node))
+	}
+	parser.Nodes = iter.expand(parser.Nodes, parser.GraphType == kernel.TypeObjectGraph)
 	return
 }
 
-// Compile is used to compile expressions
-func Compile(expr []byte) (*kernel.Graph, error) {
+// Option configures the compiling of an expression.
+type Option func(*Iterator)
+
+// WithResolver sets the Resolver used to load the files imported by the expression.
+func WithResolver(resolver Resolver) Option {
+	return func(iter *Iterator) {
+		iter.resolver = resolver
+	}
+}
+
+// WithRegistry binds the compiled graph to the registry,
+// the pipelines are checked against the processors of it and processed with them.
+func WithRegistry(registry *pipeline.Registry) Option {
+	return func(iter *Iterator) {
+		iter.registry = registry
+	}
+}
+
+// processors returns the registry which the pipelines are checked against.
+func (iter *Iterator) processors() *pipeline.Registry {
+	if iter.registry != nil {
+		return iter.registry
+	}
+	return pipeline.Default
+}
+
+// Compile is used to compile expressions,
+// the returned error is a CompileErrors which contains all the syntax errors found.
+func Compile(expr []byte, options ...Option) (*kernel.Graph, error) {
 	iterator := ParseBytes(expr)
+	for _, option := range options {
+		option(iterator)
+	}
 	parser := iterator.Read()
-	return parser, iterator.Error
+	if len(iterator.Errors) > 0 {
+		return parser, iterator.Errors
+	}
+	// the pipelines are checked when they are read
+	return parser, parser.Bind()
+}
+
+// Format is used to print expressions in the canonical layout,
+// the comments are kept and formatting a formatted expression changes nothing.
+func Format(expr []byte, options ...Option) ([]byte, error) {
+	parser, err := Compile(expr, options...)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(parser.String()), nil
+}
+
+// CompileFile is used to compile the expression file loaded by the resolver,
+// the files imported by it are loaded by the same resolver.
+func CompileFile(resolver Resolver, name string) (*kernel.Graph, error) {
+	file, expr, err := resolver.Resolve("", name)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(expr, WithResolver(resolver), func(iter *Iterator) {
+		iter.file, iter.chain = file, []string{file}
+	})
 }
@@ -0,0 +1,711 @@
+package compiler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/storyicon/graphquery/kernel"
+)
+
+func TestCompile_CompileError(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want CompileError
+	}{
+		{
+			name: "test0",
+			expr: "[{ title `text()` }]",
+			want: CompileError{
+				Operation: "ReadNode",
+				Message:   `Unexpected character "["`,
+				Line:      1,
+				Column:    1,
+				Offset:    0,
+				Actual:    "[",
+				Span:      Span{Start: 0, End: 1},
+			},
+		},
+		{
+			name: "test1",
+			expr: "{\n    title `text()`\n    url-a `attr(\"href\")`\n}",
+			want: CompileError{
+				Operation: "ReadNodeName",
+				Message:   `Unexpected character "-"`,
+				Line:      3,
+				Column:    8,
+				Offset:    28,
+				Actual:    "-",
+				Span:      Span{Start: 28, End: 29},
+			},
+		},
+		{
+			name: "test2",
+			expr: "{\n    标题 `text()`\n}",
+			want: CompileError{
+				Operation: "ReadNode",
+				Message:   `Unexpected character "标"`,
+				Line:      2,
+				Column:    5,
+				Offset:    6,
+				Actual:    "标",
+				Span:      Span{Start: 6, End: 9},
+			},
+		},
+		{
+			name: "test3",
+			expr: "{\n  title text()`\n}",
+			want: CompileError{
+				Operation: "ReadPipelines",
+				Message:   "Expect \"`\" character, but t appears.",
+				Line:      2,
+				Column:    9,
+				Offset:    10,
+				Expected:  "`",
+				Actual:    "t",
+				Span:      Span{Start: 10, End: 11},
+			},
+		},
+		{
+			name: "test4",
+			expr: "items `css(\"a\")` [{ title `text()` ",
+			want: CompileError{
+				Operation: "ReadObjectArray",
+				Message:   `Expect "}" character, but EOF appears.`,
+				Line:      1,
+				Column:    36,
+				Offset:    35,
+				Expected:  "}",
+				Actual:    TokenEOF,
+				Span:      Span{Start: 35, End: 35},
+			},
+		},
+	}
+	for _, tt := range tests {
+		_, err := Compile([]byte(tt.expr))
+		errs, ok := err.(CompileErrors)
+		if !ok || len(errs) == 0 {
+			t.Errorf("%q. Compile() error = %#v, want CompileErrors", tt.name, err)
+			continue
+		}
+		got := errs[0]
+		got.index, got.parsing, got.context = 0, "", ""
+		if *got != tt.want {
+			t.Errorf("%q. Compile() error = %#v, want %#v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestCompile_Recover(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want []string
+	}{
+		{
+			name: "test0",
+			expr: "{\n    title `text()`\n}",
+		},
+		{
+			name: "test1",
+			expr: strings.Join([]string{
+				"{",
+				"    a-b `text()`",
+				"    items `css(\".item\")` [",
+				"        c$ `text()`",
+				"        d `text()`",
+				"    ]",
+				"    e `css(\"abc)`",
+				"    f `text()` {",
+				"        g ",
+				"    }",
+				"    h `text()`",
+				"}",
+			}, "\n"),
+			want: []string{
+				`2:6 ReadNodeName: Unexpected character "-"`,
+				`4:10 ReadNodeName: Unexpected character "$"`,
+				`7:12 ReadStringTuple: Unterminated string`,
+				"10:5 ReadPipelines: Expect \"`\" character, but } appears.",
+			},
+		},
+		{
+			name: "test2",
+			expr: "{\n    a `css(\"a\")` [{ title `text()` }\n    b `text()`\n}",
+			want: []string{
+				`3:5 ReadObjectArray: Expect "]" character, but b appears.`,
+			},
+		},
+		{
+			name: "test3",
+			expr: "{\n    a `css(\"a\")` {\n        b `text()`\n",
+			want: []string{
+				`4:1 ReadObject: Expect "}" character, but EOF appears.`,
+			},
+		},
+		{
+			name: "test4",
+			expr: "{ a `text()` ] b `text()` }",
+			want: []string{
+				`1:14 ReadNode: Unexpected character "]"`,
+			},
+		},
+		{
+			name: "test5",
+			expr: "{\n    a:number `text()`\n    b: `text()`\n    c:int `css(\"a\")` [ d `text()` ]\n    e:bool `text()`\n}",
+			want: []string{
+				`2:7 ReadNodeType: Undefined type "number"`,
+				`3:7 ReadNodeType: Missing type after ":"`,
+				`4:6 ReadNodeType: Type annotation is only allowed on leaf nodes`,
+			},
+		},
+		{
+			name: "test6",
+			expr: "{\n    \"\" `text()`\n    b as `text()`\n    \"c `text()`\n}",
+			want: []string{
+				`2:5 ReadNodeName: Empty node name`,
+				"3:10 ReadNodeAlias: Unexpected character \"`\"",
+				`4:5 ReadNodeName: Unterminated string`,
+			},
+		},
+		{
+			name: "test7",
+			expr: "{\n    a:int `text()` ?? \"x\"\n    b `css(\"b\")` ?? \"\" [ c `text()` ]\n    d `text()` ?= 1\n    e `text()` ?? }",
+			want: []string{
+				`2:20 ReadDefault: Invalid default value, can not convert "x" to int`,
+				`3:18 ReadDefault: Only null can be the default value of containers`,
+				`4:16 ReadDefault: Expect "??" in front of the default value`,
+				`5:19 ReadDefault: Unexpected character "}"`,
+			},
+		},
+		{
+			name: "test8",
+			expr: "{\n    a `css(\"a\")` [{ b `text()` c `css(\"c\")` { d `text()` } }] where (b > 0 && c == 1 || e)\n    f `css(\"f\")` { g `text()` } where (g)\n    h `css(\"h\")` [ i `text()` ] where (i =~ \"(\")\n    j `css(\"j\")` [ k `text()` ] where (k > > 1)\n    l `css(\"l\")` [ m `text()` ] where (m == 1\n}",
+			want: []string{
+				`3:33 ReadFilter: Filter is only allowed on arrays`,
+				"4:45 ReadFilter: Invalid regular expression, error parsing regexp: missing closing ): `(`",
+				`5:44 ReadFilter: Unexpected character ">"`,
+				`7:1 ReadFilter: Expect ")" character, but } appears.`,
+				// the children referred by filters are checked after the fragments are expanded
+				`2:79 ReadFilter: Filter can only refer to leaf children, but "c" is not`,
+				`2:89 ReadFilter: Undefined child "e" in the filter`,
+			},
+		},
+		{
+			name: "test9",
+			expr: "{\n    a `css(\"a\")` [{ b `text()` }] sort\n    c `css(\"c\")` { d `text()` } limit 1\n    e `css(\"e\")` [ f `text()` ] limit 0\n    g `css(\"g\")` [ h `text()` ] offset x\n    i `css(\"i\")` [ j `text()` ] reverse reverse\n    k `css(\"k\")` [{ l `text()` m `css(\"m\")` [ n `text()` ] }] unique by m sort by o\n}",
+			want: []string{
+				`3:33 ReadList: List operators are only allowed on arrays`,
+				`4:33 ReadList: The number after "limit" must be greater than 0`,
+				`5:40 ReadList: Expect a number after "offset"`,
+				`6:41 ReadList: "reverse" is repeated`,
+				`2:35 ReadList: The elements of object arrays are sorted by a child, such as "sort by price"`,
+				`7:73 ReadList: List operators can only refer to leaf children, but "m" is not`,
+				`7:83 ReadList: Undefined child "o" in the list operators`,
+			},
+		},
+		{
+			name: "test10",
+			expr: "{\n    a `root(\"a\")`\n    b `replace(\" \", link(\"a\")`\n    c `root(text(), text())`\n}",
+			want: []string{
+				`2:8 ReadPipeline: The parameter of root is a pipeline, such as root(css("base"))`,
+				"3:30 ReadStringTuple: Unexpected character \"`\"",
+				`4:8 ReadPipeline: The parameter of root is a pipeline, such as root(css("base"))`,
+			},
+		},
+		{
+			name: "test11",
+			expr: "{\n    a `css(\"a\");eq(\"x\")`\n    b `css()`\n    c `replace(\"a\", \"b\", \"1\", \"2\")`\n    d `regex(\"(\")`\n    e `eq(\"{$a}\");eq(link(\"a\"));undefined(\"a\")`\n}",
+			want: []string{
+				`2:17 ReadPipeline: Invalid parameters, parameter index of method eq expects int, but "x" received`,
+				`3:8 ReadPipeline: Invalid parameters, method css expects 1 parameter, but 0 received`,
+				`4:8 ReadPipeline: Invalid parameters, method replace expects 2 to 3 parameters, but 4 received`,
+				"5:8 ReadPipeline: Invalid parameters, parameter expr of method regex expects REGEX selector, error parsing regexp: missing closing ): `(`",
+				`6:33 ReadPipeline: Undefined method "undefined"`,
+			},
+		},
+		{
+			name: "test12",
+			expr: "{\n    a `css(\"div >\")`\n    b `xpath(\"//a[\")`\n    c `css(\"{$a} > p\");json(\"\")`\n}",
+			want: []string{
+				`2:8 ReadPipeline: Invalid parameters, parameter expr of method css expects CSS selector, expected selector, found EOF instead`,
+				`3:8 ReadPipeline: Invalid parameters, parameter expr of method xpath expects XPATH selector, expression must evaluate to a node-set`,
+			},
+		},
+		{
+			name: "test13",
+			expr: "{\n    a `css(\"a\")` [ b `x(` ]\n    c `css(\"c\")` ?? \"x\n    d `undefined()`\n}",
+			want: []string{
+				"2:25 ReadStringTuple: Unexpected character \"`\"",
+				`3:21 ReadDefault: Unterminated string`,
+				`4:8 ReadPipeline: Undefined method "undefined"`,
+			},
+		},
+		{
+			name: "test14",
+			expr: "{\n    a `template(\"x\ny\")`\n    \"b `undefined()`\n    c `undefined()`\n}",
+			want: []string{
+				`4:5 ReadNodeName: Unterminated string`,
+				`5:8 ReadPipeline: Undefined method "undefined"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		graph, err := Compile([]byte(tt.expr))
+		var got []string
+		if errs, ok := err.(CompileErrors); ok {
+			for _, e := range errs {
+				got = append(got, fmt.Sprintf("%d:%d %s: %s", e.Line, e.Column, e.Operation, e.Message))
+			}
+		} else if err != nil {
+			t.Errorf("%q. Compile() error = %#v, want CompileErrors", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q. Compile() errors = %q, want %q", tt.name, got, tt.want)
+		}
+		if graph == nil {
+			t.Errorf("%q. Compile() graph = nil", tt.name)
+		}
+	}
+}
+
+func TestCompile_Comments(t *testing.T) {
+	expr := strings.Join([]string{
+		"// books of the library",
+		"{",
+		"    /* the title is",
+		"       always there */",
+		"    title `css(\"title\") /* first */; text()` // trailing",
+		"    items `xpath(\"//item\")` [{",
+		"        // leading",
+		"        name /* name */ `css (\"name\")`",
+		"        // closing",
+		"    }]",
+		"}",
+		"// end",
+	}, "\n")
+	graph, err := Compile([]byte(expr))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	comments := func(node *kernel.GraphNode) (conseq []string) {
+		for _, comment := range node.Comments {
+			conseq = append(conseq, fmt.Sprintf("%d %s", comment.Position, comment.Text))
+		}
+		return
+	}
+	tests := []struct {
+		name string
+		node *kernel.GraphNode
+		want []string
+	}{
+		{
+			name: "root",
+			node: graph.Root,
+			want: []string{
+				"0 // books of the library",
+				"1 // end",
+			},
+		},
+		{
+			name: "title",
+			node: graph.Nodes[0],
+			want: []string{
+				"0 /* the title is\n       always there */",
+				"1 /* first */",
+				"1 // trailing",
+			},
+		},
+		{
+			name: "items",
+			node: graph.Nodes[1],
+			want: []string{
+				"2 // closing",
+			},
+		},
+		{
+			name: "name",
+			node: graph.Nodes[1].Children[0],
+			want: []string{
+				"0 // leading",
+				"1 /* name */",
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := comments(tt.node); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q. GraphNode.Comments = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := graph.Nodes[1].Pipelines[0].Args[0]; got != "//item" {
+		t.Errorf("Pipeline.Args[0] = %q, want %q", got, "//item")
+	}
+	if got := graph.Nodes[1].Children[0].Pipelines[0].Name; got != "css" {
+		t.Errorf("Pipeline.Name = %q, want %q", got, "css")
+	}
+}
+
+func TestCompile_Strings(t *testing.T) {
+	expr := "{\n    body `template(\"{{ .a }}\n{{ .b }}\")` ?? \"none\n\"\n}"
+	graph, err := Compile([]byte(expr))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if got, want := graph.Nodes[0].Pipelines[0].Args[0], "{{ .a }}\n{{ .b }}"; got != want {
+		t.Errorf("Pipeline.Args[0] = %q, want %q", got, want)
+	}
+	if got, want := graph.Nodes[0].Default.Value, "none\n"; got != want {
+		t.Errorf("Default.Value = %q, want %q", got, want)
+	}
+}
+
+func TestCompile_Names(t *testing.T) {
+	expr := strings.Join([]string{
+		"{",
+		"    \"product-id\" `css(\"#id\")`",
+		"    price:float as \"价格\" `css(\".price\")`",
+		"    title as \"meta.title\" `css(\"title\")`",
+		"    as `text()`",
+		"}",
+	}, "\n")
+	graph, err := Compile([]byte(expr))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	want := []string{
+		"product-id product-id 0",
+		"price 价格 1",
+		"title meta.title 0",
+		"as as 0",
+	}
+	var got []string
+	for _, node := range graph.Nodes {
+		got = append(got, fmt.Sprintf("%s %s %d", node.Name, node.Key(), node.NodeType))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Compile() nodes = %q, want %q", got, want)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{
+			name: "test0",
+			expr: "a `css(\"a\")` [{ title `text();  trim()` url  `attr( \"href\" )` }]",
+			want: strings.Join([]string{
+				"a `css(\"a\")` [{",
+				"    title `text();trim()`",
+				"    url `attr(\"href\")`",
+				"}]",
+				"",
+			}, "\n"),
+		},
+		{
+			name: "test1",
+			expr: strings.Join([]string{
+				"// books",
+				"{ title `css(\"title\") /* first */; text()` // trailing",
+				"  items `xpath(\"//item\")` [",
+				"  name `css (\"name\") ; replace(\"\\\"\", \"\")` ]",
+				"  \"product-id\" as id `attr(\"id\")`   price:float as \"价格\" `css(\".price\")`",
+				"  author `css(\"author\")` {} empty `css(\"none\")` [{",
+				"  // closing",
+				"  }] }",
+				"// end",
+			}, "\n"),
+			want: strings.Join([]string{
+				"// books",
+				"{",
+				"    title `css(\"title\");text()` /* first */ // trailing",
+				"    items `xpath(\"//item\")` [",
+				"        name `css(\"name\");replace(\"\\\"\", \"\")`",
+				"    ]",
+				"    \"product-id\" as id `attr(\"id\")`",
+				"    price:float as \"价格\" `css(\".price\")`",
+				"    author `css(\"author\")` {}",
+				"    empty `css(\"none\")` [{",
+				"        // closing",
+				"    }]",
+				"}",
+				"// end",
+				"",
+			}, "\n"),
+		},
+		{
+			name: "test2",
+			expr: "a `text()` // one\n/* two */ // three\n",
+			want: "a `text()` // one\n/* two */\n// three\n",
+		},
+		{
+			name: "test3",
+			expr: "fragment A { a `text()` } fragment B { ...A }\n// end",
+			want: "fragment A {\n    a `text()`\n}\n\nfragment B {\n    ...A\n}\n// end\n",
+		},
+		{
+			name: "test4",
+			expr: "{ a `text()` ?? x b:float `text()`??1.5 c `css(\"c\")` ?? null [{ d:bool `text()` ?? \"true\" }] }",
+			want: strings.Join([]string{
+				"{",
+				"    a `text()` ?? \"x\"",
+				"    b:float `text()` ?? 1.5",
+				"    c `css(\"c\")` ?? null [{",
+				"        d:bool `text()` ?? true",
+				"    }]",
+				"}",
+				"",
+			}, "\n"),
+		},
+		{
+			name: "test5",
+			expr: "{ title! `css(\"h1\")` price:float! as cost `css(\".price\")` \"sku-id\"! `attr(\"sku\")` items! `css(\"li\")` [ item `text()` ] }",
+			want: strings.Join([]string{
+				"{",
+				"    title! `css(\"h1\")`",
+				"    price:float! as cost `css(\".price\")`",
+				"    \"sku-id\"! `attr(\"sku\")`",
+				"    items! `css(\"li\")` [",
+				"        item `text()`",
+				"    ]",
+				"}",
+				"",
+			}, "\n"),
+		},
+		{
+			name: "test6",
+			expr: "{ a `css(\"a\")` [{ b:float `text()` c `attr(\"c\")` d:bool `attr(\"d\")` }] where(b>0&&(c=~\"^x\"||c==null)&&!(b >= 10) && !d) e `css(\"e\")` [ f `text()` ] where (f != \"\" || (f < \"m\" && f)) // f\n where `css(\"w\")` }",
+			want: strings.Join([]string{
+				"{",
+				"    a `css(\"a\")` [{",
+				"        b:float `text()`",
+				"        c `attr(\"c\")`",
+				"        d:bool `attr(\"d\")`",
+				"    }] where (b > 0 && (c =~ \"^x\" || c == null) && !(b >= 10) && !d)",
+				"    e `css(\"e\")` [",
+				"        f `text()`",
+				"    ] where (f != \"\" || f < \"m\" && f) // f",
+				"    where `css(\"w\")`",
+				"}",
+				"",
+			}, "\n"),
+		},
+		{
+			name: "test7",
+			expr: "{ a `css(\"a\")` [{ b `text()` c:int `attr(\"c\")` }] where (c) limit 5 offset 1 sort by c numeric desc unique by b b `css(\"b\")` [ d `text()` ] sort natural asc reverse limit `css(\"l\")` }",
+			want: strings.Join([]string{
+				"{",
+				"    a `css(\"a\")` [{",
+				"        b `text()`",
+				"        c:int `attr(\"c\")`",
+				"    }] where (c) unique by b sort by c numeric desc offset 1 limit 5",
+				"    b `css(\"b\")` [",
+				"        d `text()`",
+				"    ] sort natural reverse",
+				"    limit `css(\"l\")`",
+				"}",
+				"",
+			}, "\n"),
+		},
+		{
+			name: "test8",
+			expr: "{ base `css(\"a\")` [ url `attr(\"href\");absolute( root( css(\"base\") ; attr(\"href\") ) )` ] sep `text()` title `css(\"h1\");replace(\" \",link(\"sep\"))` }",
+			want: strings.Join([]string{
+				"{",
+				"    base `css(\"a\")` [",
+				"        url `attr(\"href\");absolute(root(css(\"base\");attr(\"href\")))`",
+				"    ]",
+				"    sep `text()`",
+				"    title `css(\"h1\");replace(\" \", link(\"sep\"))`",
+				"}",
+				"",
+			}, "\n"),
+		},
+		{
+			name: "test9",
+			expr: "{ items /* list */ `css(\"li\")` // of items\n [ item `text()` ] title // the title\n `css(\"h1\")` }",
+			want: strings.Join([]string{
+				"{",
+				"    /* list */",
+				"    // of items",
+				"    items `css(\"li\")` [",
+				"        item `text()`",
+				"    ]",
+				"    title `css(\"h1\")` // the title",
+				"}",
+				"",
+			}, "\n"),
+		},
+	}
+	for _, tt := range tests {
+		got, err := Format([]byte(tt.expr))
+		if err != nil {
+			t.Errorf("%q. Format() error = %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%q. Format() = %s, want %s", tt.name, got, tt.want)
+		}
+		if again, _ := Format(got); string(again) != string(got) {
+			t.Errorf("%q. Format() is not idempotent, got %s", tt.name, again)
+		}
+		formatted, _ := Compile(got)
+		original, _ := Compile([]byte(tt.expr))
+		if !reflect.DeepEqual(strip(formatted), strip(original)) {
+			t.Errorf("%q. Format() changes the compiled graph", tt.name)
+		}
+	}
+	if _, err := Format([]byte("{ a `text()`")); err == nil {
+		t.Errorf("Format() error = nil, want the compile error")
+	}
+}
+
+// strip removes the comments of the compiled graph.
+func strip(graph *kernel.Graph) *kernel.Graph {
+	var walk func(node *kernel.GraphNode)
+	walk = func(node *kernel.GraphNode) {
+		node.Comments = nil
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(graph.Root)
+	for _, node := range graph.Nodes {
+		walk(node)
+	}
+	return graph
+}
+
+func TestCompile_Fragments(t *testing.T) {
+	expr := strings.Join([]string{
+		"// the price",
+		"fragment Price {",
+		"    amount:float `css(\".amount\")`",
+		"    ...Currency",
+		"}",
+		"fragment Currency { currency `css(\".currency\")` }",
+		"{",
+		"    title `css(\"title\")`",
+		"    price `css(\".price\")` { ...Price }",
+		"    items `css(\".item\")` [{",
+		"        name `text()`",
+		"        ...Price",
+		"    }]",
+		"}",
+	}, "\n")
+	graph, err := Compile([]byte(expr))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	var walk func(nodes []*kernel.GraphNode) string
+	walk = func(nodes []*kernel.GraphNode) string {
+		var conseq []string
+		for _, node := range nodes {
+			name := node.Name
+			if node.Fragment != "" {
+				name = node.Fragment + "." + name
+			}
+			if len(node.Children) > 0 {
+				name += "{" + walk(node.Children) + "}"
+			}
+			conseq = append(conseq, name)
+		}
+		return strings.Join(conseq, " ")
+	}
+	if got, want := walk(graph.Nodes), "title price{Price.amount Price.currency} items{name Price.amount Price.currency}"; got != want {
+		t.Errorf("Compile() nodes = %v, want %v", got, want)
+	}
+	if got, want := walk(graph.Fragments), "Price{amount Currency.currency} Currency{currency}"; got != want {
+		t.Errorf("Compile() fragments = %v, want %v", got, want)
+	}
+	if graph.Nodes[1].Children[0] == graph.Nodes[2].Children[1] {
+		t.Errorf("Compile() shares the nodes of fragment between spreads")
+	}
+
+	formatted, err := Format([]byte(expr))
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	want := strings.Join([]string{
+		"// the price",
+		"fragment Price {",
+		"    amount:float `css(\".amount\")`",
+		"    ...Currency",
+		"}",
+		"",
+		"fragment Currency {",
+		"    currency `css(\".currency\")`",
+		"}",
+		"",
+		"{",
+		"    title `css(\"title\")`",
+		"    price `css(\".price\")` {",
+		"        ...Price",
+		"    }",
+		"    items `css(\".item\")` [{",
+		"        name `text()`",
+		"        ...Price",
+		"    }]",
+		"}",
+		"",
+	}, "\n")
+	if string(formatted) != want {
+		t.Errorf("Format() = %s, want %s", formatted, want)
+	}
+}
+
+func TestCompile_FragmentErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want []string
+	}{
+		{
+			name: "test0",
+			expr: "fragment A { a `text()` ...B }\nfragment B { ...A b `text()` }\n{ ...A ...C }",
+			want: []string{
+				`2:14 ReadSpread: Fragment cycle: A -> B -> A`,
+				`3:8 ReadSpread: Undefined fragment "C"`,
+			},
+		},
+		{
+			name: "test1",
+			expr: "fragment A { a `text()` }\nfragment A { b `text()` }\nitems `css(\"a\")` [ ...A ]",
+			want: []string{
+				`2:10 ReadFragment: Fragment "A" is redefined`,
+				`3:20 ReadSpread: Fragment spread is only allowed in objects`,
+			},
+		},
+		{
+			name: "test2",
+			expr: "fragment A { a `text()` }\n...A",
+			want: []string{
+				`2:1 ReadSpread: Fragment spread is only allowed in objects`,
+			},
+		},
+		{
+			name: "test3",
+			expr: "{ .A b `text()` }",
+			want: []string{
+				`1:3 ReadSpread: Expect "..." in front of the fragment name`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		_, err := Compile([]byte(tt.expr))
+		var got []string
+		if errs, ok := err.(CompileErrors); ok {
+			for _, e := range errs {
+				got = append(got, fmt.Sprintf("%d:%d %s: %s", e.Line, e.Column, e.Operation, e.Message))
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q. Compile() errors = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenEOF is the Actual token of CompileError when the expression ends unexpectedly.
+const TokenEOF = "EOF"
+
+// Span is a range of bytes in the expression, End is exclusive.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// CompileError describes a syntax error found in the expression.
+type CompileError struct {
+	// File is the imported file in which the error was found,
+	// it is empty when the error is found in the compiled expression itself.
+	File string `json:"file,omitempty"`
+	// Operation is the read function in which the error was found, such as ReadNode.
+	Operation string `json:"operation"`
+	// Message is the description of the error.
+	Message string `json:"message"`
+	// Line and Column locate the error, both start at 1.
+	// Column is counted in characters rather than bytes.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// Offset is the byte offset of the error in the expression.
+	Offset int `json:"offset"`
+	// Expected is the expected token, it is empty when no specific token is expected.
+	Expected string `json:"expected,omitempty"`
+	// Actual is the token that appears, it is TokenEOF at the end of the expression.
+	Actual string `json:"actual,omitempty"`
+	// Span is the range of the Actual token in the expression.
+	Span Span `json:"span"`
+
+	// index, parsing and context are the excerpts used by Error,
+	// they are empty for the errors found in imported files, whose content is not quoted.
+	index            int
+	parsing, context string
+}
+
+// CompileErrors is a collection of CompileError in the order they were found.
+type CompileErrors []*CompileError
+
+var _ error = &CompileError{}
+var _ error = CompileErrors{}
+
+// Error implements the error interface.
+func (err *CompileError) Error() string {
+	if err.File != "" && err.context == "" {
+		return fmt.Sprintf("%s: %s: %s, error found at line %d column %d", err.File, err.Operation, err.Message, err.Line, err.Column)
+	}
+	msg := fmt.Sprintf("%s: %s, error found in #%v byte of ...|%s|..., bigger context ...|%s|... ",
+		err.Operation, err.Message, err.index, err.parsing, err.context)
+	if err.File != "" {
+		return err.File + ": " + msg
+	}
+	return msg
+}
+
+// same reports whether two errors describe the same problem at the same place.
+func (err *CompileError) same(other *CompileError) bool {
+	return err.File == other.File && err.Offset == other.Offset && err.Operation == other.Operation && err.Message == other.Message
+}
+
+// Error implements the error interface, the errors are separated by line breaks.
+func (errs CompileErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// newCompileError creates a CompileError of the token at offset,
+// head is the position of the iterator which is used by the excerpts of Error.
+func newCompileError(expr []byte, head int, offset int, operation string, msg string) *CompileError {
+	err := &CompileError{
+		Operation: operation,
+		Message:   msg,
+		Offset:    offset,
+		Span:      Span{Start: offset, End: offset},
+		Actual:    TokenEOF,
+	}
+	if offset < len(expr) {
+		r, size := utf8.DecodeRune(expr[offset:])
+		err.Actual = string(r)
+		err.Span.End = offset + size
+	}
+	lineStart := bytes.LastIndexByte(expr[:offset], '\n') + 1
+	err.Line = bytes.Count(expr[:offset], []byte{'\n'}) + 1
+	err.Column = utf8.RuneCount(expr[lineStart:offset]) + 1
+
+	peekStart, peekEnd := excerpt(expr, head, 10)
+	contextStart, contextEnd := excerpt(expr, head, 50)
+	err.index = head - peekStart
+	err.parsing = string(expr[peekStart:peekEnd])
+	err.context = string(expr[contextStart:contextEnd])
+	return err
+}
+
+// excerpt returns the range of at most n bytes around the position.
+func excerpt(expr []byte, position int, n int) (start int, end int) {
+	if start = position - n; start < 0 {
+		start = 0
+	}
+	if end = position + n; end > len(expr) {
+		end = len(expr)
+	}
+	return
+}
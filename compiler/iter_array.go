@@ -25,10 +25,15 @@ func (iter *Iterator) ReadArray() (nodes []*kernel.GraphNode) {
 		c = iter.nextToken()
 		switch c {
 		case ']':
+			iter.closing = iter.takeComments(kernel.CommentClosing)
 			return
+		case 0:
+			iter.ReportMismatchChar("ReadArray", ']', c)
 		default:
 			iter.unreadByte()
-			nodes = append(nodes, iter.ReadNode())
+			if node := iter.ReadNodeRecovered(']'); node != nil {
+				nodes = append(nodes, node)
+			}
 		}
 	}
 }
@@ -48,13 +53,19 @@ func (iter *Iterator) ReadObjectArray() (nodes []*kernel.GraphNode) {
 			head := iter.head
 			c = iter.nextToken()
 			if c != ']' {
+				offset := iter.tokenOffset(c)
 				iter.head = head
-				iter.ReportMismatchChar("ReadObjectArray", ']', c)
+				iter.reportMismatchAt("ReadObjectArray", offset, ']', c)
 			}
+			iter.closing = iter.takeComments(kernel.CommentClosing)
 			return
+		case 0:
+			iter.ReportMismatchChar("ReadObjectArray", '}', c)
 		default:
 			iter.unreadByte()
-			nodes = append(nodes, iter.ReadNode())
+			if node := iter.ReadNodeRecovered('}'); node != nil {
+				nodes = append(nodes, node)
+			}
 		}
 	}
 }
@@ -0,0 +1,87 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package compiler
+
+import (
+	"bytes"
+
+	"github.com/storyicon/graphquery/kernel"
+)
+
+// pendingComment is a comment that has been read but not attached to a node yet.
+type pendingComment struct {
+	text string
+	// newline reports whether a line break separates the comment from the token before it.
+	newline bool
+}
+
+// commentEnd returns the end of the comment which starts at offset,
+// it returns offset itself when there is no comment.
+func (iter *Iterator) commentEnd(offset int) int {
+	if offset+1 >= iter.tail || iter.bytes[offset] != '/' {
+		return offset
+	}
+	switch iter.bytes[offset+1] {
+	case '/':
+		if end := bytes.IndexByte(iter.bytes[offset:iter.tail], '\n'); end >= 0 {
+			return offset + end
+		}
+		return iter.tail
+	case '*':
+		if end := bytes.Index(iter.bytes[offset+2:iter.tail], []byte("*/")); end >= 0 {
+			return offset + 2 + end + 2
+		}
+		iter.reportAt("ReadComment", offset, "Unterminated comment")
+	}
+	return offset
+}
+
+// recordComment keeps the comment in [start, end) until it is attached to a node,
+// prev is the end of the token or comment before it.
+// A comment is recorded only once even if it is read again after unreadByte.
+func (iter *Iterator) recordComment(prev int, start int, end int) {
+	if start < iter.commented {
+		return
+	}
+	iter.commented = end
+	iter.comments = append(iter.comments, pendingComment{
+		text:    string(iter.bytes[start:end]),
+		newline: bytes.IndexByte(iter.bytes[prev:start], '\n') >= 0,
+	})
+}
+
+// takeComments attaches all the pending comments at the given position.
+func (iter *Iterator) takeComments(position int) (comments []*kernel.Comment) {
+	for _, pending := range iter.comments {
+		comments = append(comments, &kernel.Comment{
+			Text:     pending.text,
+			Position: position,
+		})
+	}
+	iter.comments = nil
+	return
+}
+
+// takeTrailingComments attaches the pending comments on the same line as the previous token.
+func (iter *Iterator) takeTrailingComments() (comments []*kernel.Comment) {
+	i := 0
+	for ; i < len(iter.comments) && !iter.comments[i].newline; i++ {
+		comments = append(comments, &kernel.Comment{
+			Text:     iter.comments[i].text,
+			Position: kernel.CommentTrailing,
+		})
+	}
+	iter.comments = iter.comments[i:]
+	return
+}
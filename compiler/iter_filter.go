@@ -0,0 +1,184 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/storyicon/graphquery/kernel"
+)
+
+// ReadFilter attempts to read the filter following the children of an array node,
+// such as `where (price > 0 && name =~ "^A")`. It returns nil when there is no filter,
+// offset is the offset of "where".
+func (iter *Iterator) ReadFilter() (filter *kernel.Predicate, offset int) {
+	if iter.WhatIsNext() != SignalName || !iter.isKeyword("where") {
+		return nil, iter.head
+	}
+	// "where" is the name of the next node unless it is followed by "("
+	offset = iter.head
+	iter.head += len("where")
+	if iter.WhatIsNextByte() != '(' {
+		iter.head = offset
+		return nil, offset
+	}
+	iter.nextToken()
+	filter = iter.readOr()
+	if c := iter.nextToken(); c != ')' {
+		iter.ReportMismatchChar("ReadFilter", ')', c)
+	}
+	return filter, offset
+}
+
+// readOr reads the predicates joined by "||".
+func (iter *Iterator) readOr() *kernel.Predicate {
+	operands := []*kernel.Predicate{iter.readAnd()}
+	for iter.isOperatorNext(kernel.OpOr) {
+		iter.head += len(kernel.OpOr)
+		operands = append(operands, iter.readAnd())
+	}
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	return &kernel.Predicate{Op: kernel.OpOr, Operands: operands}
+}
+
+// readAnd reads the predicates joined by "&&".
+func (iter *Iterator) readAnd() *kernel.Predicate {
+	operands := []*kernel.Predicate{iter.readUnary()}
+	for iter.isOperatorNext(kernel.OpAnd) {
+		iter.head += len(kernel.OpAnd)
+		operands = append(operands, iter.readUnary())
+	}
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	return &kernel.Predicate{Op: kernel.OpAnd, Operands: operands}
+}
+
+// readUnary reads a predicate which may be negated by "!".
+func (iter *Iterator) readUnary() *kernel.Predicate {
+	if iter.isOperatorNext(kernel.OpNot) {
+		iter.head += len(kernel.OpNot)
+		return &kernel.Predicate{Op: kernel.OpNot, Operands: []*kernel.Predicate{iter.readUnary()}}
+	}
+	if iter.WhatIsNextByte() == '(' {
+		iter.nextToken()
+		predicate := iter.readOr()
+		if c := iter.nextToken(); c != ')' {
+			iter.ReportMismatchChar("ReadFilter", ')', c)
+		}
+		return predicate
+	}
+	return iter.readComparison()
+}
+
+// readComparison reads an operand, or two operands compared by one of kernel.Comparisons.
+func (iter *Iterator) readComparison() *kernel.Predicate {
+	left := iter.readOperand()
+	for _, op := range kernel.Comparisons {
+		if !iter.isOperatorNext(op) {
+			continue
+		}
+		iter.head += len(op)
+		start := iter.head
+		right := iter.readOperand()
+		if op == kernel.OpMatch || op == kernel.OpNotMatch {
+			iter.checkPattern(op, right, start)
+		}
+		return &kernel.Predicate{Op: op, Operands: []*kernel.Predicate{left, right}}
+	}
+	return left
+}
+
+// readOperand reads a child name, a quoted string, a number, true, false or null.
+func (iter *Iterator) readOperand() *kernel.Predicate {
+	c := iter.nextToken()
+	start := iter.tokenOffset(c)
+	if c == '"' {
+		return &kernel.Predicate{Op: kernel.OperandString, Value: iter.readString("ReadFilter")}
+	}
+	if !isLiteral(c) {
+		iter.ReportUnExpectedChar("ReadFilter", c)
+	}
+	end := start
+	for end < iter.tail && isLiteral(iter.bytes[end]) {
+		end++
+	}
+	iter.head = end
+	word := string(iter.bytes[start:end])
+	if _, err := strconv.ParseFloat(word, 64); err == nil {
+		return &kernel.Predicate{Op: kernel.OperandNumber, Value: word}
+	}
+	switch word {
+	case "true", "false":
+		return &kernel.Predicate{Op: kernel.OperandBool, Value: word}
+	case "null":
+		return &kernel.Predicate{Op: kernel.OperandNull}
+	}
+	for i := start; i < end; i++ {
+		if signalValue[iter.bytes[i]] != SignalName {
+			iter.reportAt("ReadFilter", start, fmt.Sprintf(`Invalid operand "%s"`, word))
+		}
+	}
+	operand := &kernel.Predicate{Op: kernel.OperandChild, Value: word}
+	iter.references[operand] = start
+	return operand
+}
+
+// checkPattern checks the right operand of "=~" and "!~", which is a regular expression.
+func (iter *Iterator) checkPattern(op string, pattern *kernel.Predicate, offset int) {
+	offset = iter.skipWhitespace(offset)
+	if pattern.Op != kernel.OperandString {
+		iter.reportAt("ReadFilter", offset, fmt.Sprintf(`Expect a quoted regular expression after "%s"`, op))
+	}
+	if _, err := regexp.Compile(pattern.Value); err != nil {
+		iter.reportAt("ReadFilter", offset, fmt.Sprintf("Invalid regular expression, %s", err))
+	}
+}
+
+// isOperatorNext reports whether the operator is the next element.
+func (iter *Iterator) isOperatorNext(op string) bool {
+	if iter.WhatIsNextByte() == 0 {
+		return false
+	}
+	if !bytes.HasPrefix(iter.bytes[iter.head:iter.tail], []byte(op)) {
+		return false
+	}
+	// "!" is the prefix of "!=" and "!~"
+	return op != kernel.OpNot || !iter.isOperatorNext("!=") && !iter.isOperatorNext(kernel.OpNotMatch)
+}
+
+// skipWhitespace returns the offset of the first byte from offset which is not a whitespace.
+func (iter *Iterator) skipWhitespace(offset int) int {
+	for offset < iter.tail && isSpace(iter.bytes[offset]) {
+		offset++
+	}
+	return offset
+}
+
+// checkFilter checks that the filter of node only refers to the leaf children of it,
+// it is called after the fragment spreads in the children are expanded.
+func (iter *Iterator) checkFilter(node *kernel.GraphNode, predicate *kernel.Predicate) {
+	for _, operand := range predicate.Operands {
+		iter.checkFilter(node, operand)
+	}
+	if predicate.Op != kernel.OperandChild {
+		return
+	}
+	iter.checkChild(node, predicate.Value, iter.references[predicate], "ReadFilter", "Filter")
+}
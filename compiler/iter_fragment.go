@@ -0,0 +1,184 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/storyicon/graphquery/kernel"
+)
+
+// fragment is a fragment definition read from the byte stream.
+type fragment struct {
+	node *kernel.GraphNode
+	// expanded reports whether the spreads in the fragment have been expanded.
+	expanded bool
+}
+
+// ReadFragments attempts to read the fragment definitions in front of the expression.
+func (iter *Iterator) ReadFragments() (fragments []*kernel.GraphNode) {
+	for iter.isStatementNext("fragment", iter.isNameNext) {
+		if node := iter.ReadFragment(); node != nil {
+			fragments = append(fragments, node)
+		}
+	}
+	return
+}
+
+// isStatementNext reports whether the next element is a statement which starts with the keyword,
+// next reports whether the element following the keyword is the one expected by the statement.
+func (iter *Iterator) isStatementNext(keyword string, next func() bool) bool {
+	if iter.WhatIsNext() != SignalName || !iter.isKeyword(keyword) {
+		return false
+	}
+	head := iter.head
+	defer func() { iter.head = head }()
+	iter.head += len(keyword)
+	return next()
+}
+
+// ReadFragment attempts to read a fragment definition such as "fragment Price { ... }",
+// it returns nil when the fragment has been defined.
+func (iter *Iterator) ReadFragment() *kernel.GraphNode {
+	comments := iter.takeComments(kernel.CommentLeading)
+	iter.head += len("fragment")
+	iter.WhatIsNext()
+	start := iter.head
+	node := &kernel.GraphNode{
+		Comments: comments,
+		Name:     iter.ReadNodeName(),
+		NodeType: kernel.TypeObject,
+	}
+	iter.closing = nil
+	node.Children = iter.ReadObject()
+	node.Comments = append(node.Comments, iter.closing...)
+	iter.closing = nil
+	iter.WhatIsNextByte()
+	node.Comments = append(node.Comments, iter.takeTrailingComments()...)
+
+	if !iter.define(node, false, "ReadFragment", start) {
+		return nil
+	}
+	return node
+}
+
+// define defines the fragment, it reports false when the fragment has been defined.
+// expanded reports whether the spreads in the fragment have been expanded.
+func (iter *Iterator) define(node *kernel.GraphNode, expanded bool, operation string, offset int) bool {
+	if _, exists := iter.fragments[node.Name]; exists {
+		iter.recordAt(operation, offset, fmt.Sprintf(`Fragment "%s" is redefined`, node.Name))
+		return false
+	}
+	iter.fragments[node.Name] = &fragment{
+		node:     node,
+		expanded: expanded,
+	}
+	return true
+}
+
+// ReadSpread attempts to read a fragment spread such as "...Price" from the byte stream,
+// it returns a placeholder which is replaced by the nodes of the fragment when the
+// whole expression has been read, so that a fragment can be used before it is defined.
+func (iter *Iterator) ReadSpread() *kernel.GraphNode {
+	iter.WhatIsNext()
+	start := iter.head
+	if !bytes.HasPrefix(iter.bytes[start:iter.tail], []byte("...")) {
+		iter.reportAt("ReadSpread", start, `Expect "..." in front of the fragment name`)
+	}
+	iter.head += len("...")
+	if iter.head >= iter.tail || !isNameStart(iter.bytes[iter.head]) {
+		iter.reportUnexpectedAt("ReadSpread", iter.head, 0)
+	}
+	node := &kernel.GraphNode{
+		Fragment: iter.ReadNodeName(),
+	}
+	iter.spreads[node] = start
+	return node
+}
+
+// expand replaces the fragment spreads in nodes with copies of the nodes of the fragments,
+// spreadable reports whether nodes are the children of an object, where spreads are allowed.
+func (iter *Iterator) expand(nodes []*kernel.GraphNode, spreadable bool) (conseq []*kernel.GraphNode) {
+	for _, node := range nodes {
+		offset, isSpread := iter.spreads[node]
+		if !isSpread {
+			objective := node.NodeType == kernel.TypeObject || node.NodeType == kernel.TypeObjectArray
+			node.Children = iter.expand(node.Children, objective)
+			if node.Filter != nil {
+				iter.checkFilter(node, node.Filter)
+			}
+			if node.List != nil {
+				iter.checkList(node)
+			}
+			conseq = append(conseq, node)
+			continue
+		}
+		name := node.Fragment
+		fragment, exists := iter.fragments[name]
+		switch {
+		case !spreadable:
+			iter.recordAt("ReadSpread", offset, "Fragment spread is only allowed in objects")
+		case !exists:
+			iter.recordAt("ReadSpread", offset, fmt.Sprintf(`Undefined fragment "%s"`, name))
+		case iter.isExpanding(name):
+			cycle := append(append([]string{}, iter.expanding[iter.indexExpanding(name):]...), name)
+			iter.recordAt("ReadSpread", offset, fmt.Sprintf("Fragment cycle: %s", strings.Join(cycle, " -> ")))
+		default:
+			for _, child := range iter.expandFragment(fragment.node).Children {
+				child = copyNode(child)
+				child.Fragment = name
+				conseq = append(conseq, child)
+			}
+		}
+	}
+	return
+}
+
+// expandFragment expands the spreads in the fragment definition, it is done only once.
+func (iter *Iterator) expandFragment(node *kernel.GraphNode) *kernel.GraphNode {
+	fragment := iter.fragments[node.Name]
+	if fragment.expanded {
+		return node
+	}
+	iter.expanding = append(iter.expanding, node.Name)
+	node.Children = iter.expand(node.Children, true)
+	iter.expanding = iter.expanding[:len(iter.expanding)-1]
+	fragment.expanded = true
+	return node
+}
+
+func (iter *Iterator) isExpanding(name string) bool {
+	return iter.indexExpanding(name) >= 0
+}
+
+func (iter *Iterator) indexExpanding(name string) int {
+	for i, expanding := range iter.expanding {
+		if expanding == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// copyNode returns a deep copy of the node and its children.
+func copyNode(node *kernel.GraphNode) *kernel.GraphNode {
+	conseq := *node
+	conseq.Children = nil
+	for _, child := range node.Children {
+		conseq.Children = append(conseq.Children, copyNode(child))
+	}
+	return &conseq
+}
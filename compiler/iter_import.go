@@ -0,0 +1,97 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/storyicon/graphquery/kernel"
+)
+
+// ReadImports attempts to read the imports in front of the expression,
+// such as `import "price.gq"` or `import "breadcrumbs.gq" as Breadcrumbs`.
+func (iter *Iterator) ReadImports() (imports []*kernel.Import) {
+	for iter.isStatementNext("import", func() bool { return iter.WhatIsNext() == SignalString }) {
+		imports = append(imports, iter.ReadImport())
+	}
+	return
+}
+
+// ReadImport attempts to read an import and takes the fragments of the imported file.
+// When the import has an alias, the nodes of the imported file are taken as a fragment named by it.
+func (iter *Iterator) ReadImport() *kernel.Import {
+	iter.head += len("import")
+	iter.nextToken()
+	start := iter.head - 1
+	imported := &kernel.Import{
+		Path: iter.readString("ReadImport"),
+	}
+	if iter.WhatIsNext() == SignalName && iter.isKeyword("as") {
+		iter.head += len("as")
+		if !iter.isNameNext() {
+			iter.ReportUnExpectedChar("ReadImport", iter.nextToken())
+		}
+		imported.Alias = iter.ReadNodeName()
+	}
+	iter.load(imported, start)
+	return imported
+}
+
+// load compiles the imported file with the same resolver and defines its fragments.
+func (iter *Iterator) load(imported *kernel.Import, offset int) {
+	if iter.resolver == nil {
+		iter.recordAt("ReadImport", offset, fmt.Sprintf(`Failed to import "%s": no resolver is set`, imported.Path))
+		return
+	}
+	file, expr, err := iter.resolver.Resolve(iter.file, imported.Path)
+	if file == "" {
+		file = imported.Path
+	}
+	chain := append(append([]string{}, iter.chain...), file)
+	if err != nil {
+		iter.recordAt("ReadImport", offset, fmt.Sprintf(`Failed to import "%s": %s, import chain: %s`,
+			imported.Path, err, strings.Join(chain, " -> "),
+		))
+		return
+	}
+	for _, importing := range iter.chain {
+		if importing == file {
+			iter.recordAt("ReadImport", offset, fmt.Sprintf("Import cycle: %s", strings.Join(chain, " -> ")))
+			return
+		}
+	}
+
+	sub := ParseBytes(expr)
+	sub.resolver, sub.file, sub.chain, sub.registry = iter.resolver, file, chain, iter.registry
+	graph := sub.Read()
+	for _, err := range sub.Errors {
+		if err.File == "" {
+			// the content of the imported file is not quoted, it may not be an expression at all
+			err.File, err.parsing, err.context = file, "", ""
+		}
+		iter.record(err)
+	}
+	// only the fragments defined in the file are taken, not the ones it imports
+	for _, node := range graph.Fragments {
+		iter.define(node, true, "ReadImport", offset)
+	}
+	if imported.Alias != "" {
+		iter.define(&kernel.GraphNode{
+			Name:     imported.Alias,
+			NodeType: kernel.TypeObject,
+			Children: graph.Nodes,
+		}, true, "ReadImport", offset)
+	}
+}
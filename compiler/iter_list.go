@@ -0,0 +1,172 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/storyicon/graphquery/kernel"
+)
+
+// listKeywords are the keywords of the list operators.
+var listKeywords = []string{"unique", "sort", "reverse", "offset", "limit"}
+
+// listKey is a child referred by the list operators, such as the id of `unique by id`,
+// the list operators themselves are keyed with an empty keyword.
+type listKey struct {
+	list    *kernel.ListOperators
+	keyword string
+}
+
+// ReadListOperators attempts to read the list operators following the children and the filter of an array node,
+// such as `unique by id sort by price numeric desc offset 10 limit 20`.
+// It returns nil when there is no list operator, offset is the offset of the first one.
+func (iter *Iterator) ReadListOperators() (list *kernel.ListOperators, offset int) {
+	read := map[string]bool{}
+	for {
+		keyword := ""
+		for _, word := range listKeywords {
+			if iter.isWordNext(word) {
+				keyword = word
+				break
+			}
+		}
+		if keyword == "" {
+			return
+		}
+		start := iter.head
+		if list == nil {
+			list, offset = &kernel.ListOperators{}, start
+			iter.listKeys[listKey{list, ""}] = start
+		}
+		if read[keyword] {
+			iter.reportAt("ReadList", start, fmt.Sprintf(`"%s" is repeated`, keyword))
+		}
+		read[keyword] = true
+		iter.head += len(keyword)
+		switch keyword {
+		case "unique":
+			list.Unique = true
+			list.UniqueBy = iter.readListKey(list, keyword)
+		case "sort":
+			list.Sort = true
+			list.SortBy = iter.readListKey(list, keyword)
+			list.SortMode = kernel.SortString
+			for _, mode := range []string{kernel.SortString, kernel.SortNumeric, kernel.SortNatural} {
+				if iter.isWordNext(mode) {
+					iter.head += len(mode)
+					list.SortMode = mode
+					break
+				}
+			}
+			if iter.isWordNext("asc") {
+				iter.head += len("asc")
+			} else if iter.isWordNext("desc") {
+				iter.head += len("desc")
+				list.Descending = true
+			}
+		case "reverse":
+			list.Reverse = true
+		case "offset":
+			list.Offset = iter.readCount(keyword)
+		case "limit":
+			if list.Limit = iter.readCount(keyword); list.Limit == 0 {
+				iter.recordAt("ReadList", start, `The number after "limit" must be greater than 0`)
+			}
+		}
+	}
+}
+
+// readListKey reads the child following "by", it returns an empty string when there is no "by".
+func (iter *Iterator) readListKey(list *kernel.ListOperators, keyword string) string {
+	if !iter.isWordNext("by") {
+		return ""
+	}
+	iter.head += len("by")
+	if !iter.isNameNext() {
+		iter.ReportUnExpectedChar("ReadList", iter.nextToken())
+	}
+	iter.listKeys[listKey{list, keyword}] = iter.head
+	if iter.bytes[iter.head] == '"' {
+		iter.head++
+		return iter.readString("ReadList")
+	}
+	start := iter.head
+	for iter.head < iter.tail && signalValue[iter.bytes[iter.head]] == SignalName {
+		iter.head++
+	}
+	return string(iter.bytes[start:iter.head])
+}
+
+// readCount reads the non-negative integer following the keyword.
+func (iter *Iterator) readCount(keyword string) int {
+	c := iter.nextToken()
+	start := iter.tokenOffset(c)
+	end := start
+	for end < iter.tail && iter.bytes[end] >= '0' && iter.bytes[end] <= '9' {
+		end++
+	}
+	count, err := strconv.Atoi(string(iter.bytes[start:end]))
+	if err != nil {
+		iter.reportAt("ReadList", start, fmt.Sprintf(`Expect a number after "%s"`, keyword))
+	}
+	iter.head = end
+	return count
+}
+
+// isWordNext reports whether the word is the next element and it is not the name of a node,
+// which is followed by its type, required marker, alias or pipelines.
+func (iter *Iterator) isWordNext(word string) bool {
+	if iter.WhatIsNext() != SignalName || !iter.isKeyword(word) {
+		return false
+	}
+	head := iter.head
+	iter.head += len(word)
+	c := iter.WhatIsNextByte()
+	named := c == '`' || c == ':' || c == '!' || signalValue[c] == SignalName && iter.isKeyword("as")
+	iter.head = head
+	return !named
+}
+
+// checkList checks that the list operators of node only refer to the leaf children of it,
+// and that the elements of an object array are sorted by a child.
+func (iter *Iterator) checkList(node *kernel.GraphNode) {
+	list := node.List
+	if list.Sort && list.SortBy == "" && node.NodeType == kernel.TypeObjectArray {
+		iter.recordAt("ReadList", iter.listKeys[listKey{list, ""}],
+			`The elements of object arrays are sorted by a child, such as "sort by price"`)
+	}
+	if list.UniqueBy != "" {
+		iter.checkChild(node, list.UniqueBy, iter.listKeys[listKey{list, "unique"}], "ReadList", "List operators")
+	}
+	if list.SortBy != "" {
+		iter.checkChild(node, list.SortBy, iter.listKeys[listKey{list, "sort"}], "ReadList", "List operators")
+	}
+}
+
+// checkChild checks that the child referred by the operation is a leaf child of node.
+func (iter *Iterator) checkChild(node *kernel.GraphNode, name string, offset int, operation string, subject string) {
+	for _, child := range node.Children {
+		if child.Name != name {
+			continue
+		}
+		if !kernel.IsLeafType(child.NodeType) {
+			iter.recordAt(operation, offset, fmt.Sprintf(`%s can only refer to leaf children, but "%s" is not`, subject, child.Name))
+		}
+		return
+	}
+	iter.recordAt(operation, offset, fmt.Sprintf(`Undefined child "%s" in the %s`, name, strings.ToLower(subject)))
+}
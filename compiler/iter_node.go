@@ -14,6 +14,8 @@
 package compiler
 
 import (
+	"bytes"
+	"fmt"
 	"strings"
 
 	"github.com/storyicon/graphquery/kernel"
@@ -22,34 +24,331 @@ import (
 
 // ReadNode attempts to read a Node from the byte stream.
 func (iter *Iterator) ReadNode() (node *kernel.GraphNode) {
-	valueType := iter.WhatIsNext()
-	if valueType != SignalName {
+	if iter.WhatIsNextByte() == '.' {
+		return iter.ReadSpread()
+	}
+	if !iter.isNameNext() {
 		iter.ReportUnExpectedChar("ReadNode", iter.nextToken())
 		return
 	}
 	node = &kernel.GraphNode{
-		Name:      iter.ReadNodeName(),
-		Pipelines: iter.ReadPipelines(),
+		Comments: iter.takeComments(kernel.CommentLeading),
+		Name:     iter.ReadNodeName(),
+	}
+	annotation := iter.head
+	dataType, annotated := iter.ReadNodeType()
+	node.Required = iter.ReadRequired()
+	node.Alias = iter.ReadNodeAlias()
+	node.Pipelines = iter.ReadPipelines()
+	// the comments read so far are in the header of the node, such as the ones between its name and its pipelines,
+	// they follow a leaf node and precede a container
+	header := iter.takeComments(kernel.CommentTrailing)
+	var fallback int
+	node.Default, fallback = iter.ReadDefault()
+	c := iter.WhatIsNextByte()
+	container := c == '[' || c == '{'
+	if annotated && container {
+		// only leaf nodes can be annotated, the type of a container is decided by its children
+		iter.reportAt("ReadNodeType", annotation, "Type annotation is only allowed on leaf nodes")
+	}
+	if node.Default != nil {
+		iter.checkDefault(node.Default, dataType, container, fallback)
 	}
+	if container {
+		// the comments in the header of a container belong to it rather than to its first child
+		for _, comment := range header {
+			comment.Position = kernel.CommentLeading
+		}
+		header = append(header, iter.takeComments(kernel.CommentLeading)...)
+	}
+	node.Comments = append(node.Comments, header...)
+	iter.closing = nil
 	node.NodeType, node.Children = iter.ReadChildren()
+	if annotated {
+		node.NodeType = dataType
+	}
+	node.Comments = append(node.Comments, iter.closing...)
+	iter.closing = nil
+	array := node.NodeType == kernel.TypeArray || node.NodeType == kernel.TypeObjectArray
+	var filtered, listed int
+	if node.Filter, filtered = iter.ReadFilter(); node.Filter != nil && !array {
+		iter.recordAt("ReadFilter", filtered, "Filter is only allowed on arrays")
+	}
+	if node.List, listed = iter.ReadListOperators(); node.List != nil && !array {
+		iter.recordAt("ReadList", listed, "List operators are only allowed on arrays")
+	}
+	// look ahead for the comments on the same line
+	iter.WhatIsNextByte()
+	node.Comments = append(node.Comments, iter.takeTrailingComments()...)
 	return
 }
 
-// ReadNodeName attempts to read a continuous node name from the byte stream.
+// ReadNodeRecovered attempts to read a Node from the byte stream like ReadNode,
+// but when a syntax error is found in the node, the error is recorded and the node is skipped
+// to the next node boundary, so that the errors of the following nodes can be found in one pass.
+// closer is the character that closes the enclosing container.
+func (iter *Iterator) ReadNodeRecovered(closer byte) (node *kernel.GraphNode) {
+	start := iter.head
+	defer func() {
+		if e := recover(); e != nil {
+			err, ok := e.(*CompileError)
+			if !ok {
+				panic(e)
+			}
+			node = nil
+			iter.skipNode(start, err.Offset, closer)
+		}
+	}()
+	return iter.ReadNode()
+}
+
+// skipNode moves the iterator from the beginning of a broken node to the next node boundary
+// at the same nesting level: the next node name after the error, the closer of the
+// enclosing container, or the end of the expression.
+func (iter *Iterator) skipNode(start int, offset int, closer byte) {
+	// openers stores the unclosed brackets of the broken node
+	var openers []byte
+	for i := start; i < iter.tail; i++ {
+		c := iter.bytes[i]
+		switch {
+		case iter.commentEnd(i) > i:
+			i = iter.commentEnd(i) - 1
+		case c == '`':
+			// the content of pipelines is skipped as a whole,
+			// but after the error a backtick may be a stray one, it only pairs within the line.
+			rest := iter.bytes[i+1 : iter.tail]
+			if i >= offset {
+				if eol := bytes.IndexByte(rest, '\n'); eol >= 0 {
+					rest = rest[:eol]
+				}
+			}
+			if end := bytes.IndexByte(rest, '`'); end >= 0 {
+				i += end + 1
+			}
+		case c == '?':
+			// the default value after "??" is skipped with it, it is not a node name
+			i = iter.skipDefault(i) - 1
+		case c == '{' || c == '[' || c == '(':
+			openers = append(openers, c)
+		case c == ')':
+			if depth := len(openers); depth > 0 && openers[depth-1] == '(' {
+				openers = openers[:depth-1]
+			}
+		case c == '}' || c == ']':
+			depth := len(openers)
+			if depth > 0 && openers[depth-1] == opener(c) {
+				openers = openers[:depth-1]
+				continue
+			}
+			// an unmatched closer after the error is taken as the closer of the enclosing container
+			if c == closer && i >= offset {
+				iter.head = i
+				return
+			}
+			if depth > 0 {
+				openers = openers[:depth-1]
+			}
+		case len(openers) == 0 && i > offset && isNameStart(c) && isSeparator(iter.bytes[i-1]):
+			iter.head = i
+			return
+		case c == '"':
+			// the brackets in strings, such as the patterns of filters, are not counted,
+			// an unterminated string is skipped to the end of its line
+			i = iter.stringEnd(i) - 1
+		}
+	}
+	iter.head = iter.tail
+}
+
+// skipDefault returns the end of the default value whose operator starts at offset.
+func (iter *Iterator) skipDefault(offset int) int {
+	i := offset
+	for i < iter.tail && !isSpace(iter.bytes[i]) && !isLiteral(iter.bytes[i]) && iter.bytes[i] != '"' {
+		i++
+	}
+	for i < iter.tail && isSpace(iter.bytes[i]) {
+		i++
+	}
+	if i < iter.tail && iter.bytes[i] == '"' {
+		return iter.stringEnd(i)
+	}
+	for i < iter.tail && isLiteral(iter.bytes[i]) {
+		i++
+	}
+	return i
+}
+
+// isSpace reports whether c is a whitespace.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\r'
+}
+
+// opener returns the opening bracket of a closing bracket.
+func opener(c byte) byte {
+	if c == '}' {
+		return '{'
+	}
+	return '['
+}
+
+// isNameStart reports whether c can be the first character of a node name.
+func isNameStart(c byte) bool {
+	return signalValue[c] == SignalName || signalValue[c] == SignalString
+}
+
+// isNameNext reports whether the next element is a node name.
+func (iter *Iterator) isNameNext() bool {
+	valueType := iter.WhatIsNext()
+	return valueType == SignalName || valueType == SignalString
+}
+
+// isKeyword reports whether the keyword is at the head of the byte stream.
+func (iter *Iterator) isKeyword(keyword string) bool {
+	end := iter.head + len(keyword)
+	if end > iter.tail || string(iter.bytes[iter.head:end]) != keyword {
+		return false
+	}
+	return end == iter.tail || signalValue[iter.bytes[end]] != SignalName
+}
+
+// isSeparator reports whether c can appear in front of a node name.
+func isSeparator(c byte) bool {
+	switch c {
+	case ' ', '\n', '\t', '\r', ';', '`', '}', ']':
+		return true
+	}
+	return false
+}
+
+// ReadNodeName attempts to read a continuous node name from the byte stream,
+// the name can also be quoted, such as "product-id", to contain any characters.
 func (iter *Iterator) ReadNodeName() (name string) {
+	if iter.head < iter.tail && iter.bytes[iter.head] == '"' {
+		start := iter.head
+		iter.head++
+		if name = iter.readString("ReadNodeName"); name == "" {
+			iter.reportAt("ReadNodeName", start, "Empty node name")
+		}
+		return
+	}
 	for i := iter.head; i < iter.tail; i++ {
 		c := iter.bytes[i]
-		if c == ' ' {
+		switch {
+		case c == ' ', c == '\n', c == '\t', c == '\r':
 			name = string(iter.bytes[iter.head:i])
 			iter.head = i + 1
 			return
-		} else if signalValue[c] != SignalName {
-			iter.ReportUnExpectedChar("ReadNodeName", c)
+		case c == ':', c == '!', iter.commentEnd(i) > i:
+			name = string(iter.bytes[iter.head:i])
+			iter.head = i
+			return
+		case signalValue[c] != SignalName:
+			iter.reportUnexpectedAt("ReadNodeName", i, c)
+		}
+	}
+	return
+}
+
+// ReadNodeType attempts to read the type annotation following a node name, such as ":float",
+// it returns kernel.TypeString when the node is not annotated.
+func (iter *Iterator) ReadNodeType() (dataType int, annotated bool) {
+	if iter.head >= iter.tail || iter.bytes[iter.head] != ':' {
+		return kernel.TypeString, false
+	}
+	iter.head++
+	start := iter.head
+	name := iter.ReadNodeName()
+	dataType, ok := kernel.LeafType(name)
+	if !ok {
+		msg := fmt.Sprintf(`Undefined type "%s"`, name)
+		if name == "" {
+			msg = "Missing type after \":\""
 		}
+		iter.reportAt("ReadNodeType", start, msg)
+	}
+	return dataType, true
+}
+
+// ReadRequired attempts to read the required marker following the node name and type,
+// such as "title!" or "price:float!".
+func (iter *Iterator) ReadRequired() bool {
+	if iter.head >= iter.tail || iter.bytes[iter.head] != '!' {
+		return false
+	}
+	iter.head++
+	return true
+}
+
+// ReadNodeAlias attempts to read the alias following the node name and type, such as `as "product-id"`,
+// the alias is the key of the node in the output. It returns an empty string when there is no alias.
+func (iter *Iterator) ReadNodeAlias() (alias string) {
+	if iter.WhatIsNext() != SignalName || !iter.isKeyword("as") {
+		return ""
+	}
+	iter.head += len("as")
+	if !iter.isNameNext() {
+		iter.ReportUnExpectedChar("ReadNodeAlias", iter.nextToken())
+	}
+	return iter.ReadNodeName()
+}
+
+// ReadDefault attempts to read the default value following the pipelines,
+// such as `?? "USD"`, `?? 0`, `?? true` or `?? null`.
+// It returns nil when the node has no default value, offset is the offset of "??".
+func (iter *Iterator) ReadDefault() (fallback *kernel.Default, offset int) {
+	if iter.WhatIsNextByte() != '?' {
+		return nil, iter.head
+	}
+	offset = iter.head
+	if !bytes.HasPrefix(iter.bytes[offset:iter.tail], []byte("??")) {
+		iter.reportAt("ReadDefault", offset, `Expect "??" in front of the default value`)
+	}
+	iter.head += len("??")
+	c := iter.nextToken()
+	switch {
+	case c == '"':
+		fallback = &kernel.Default{
+			Value: iter.readString("ReadDefault"),
+		}
+	case isLiteral(c):
+		start := iter.head - 1
+		for iter.head < iter.tail && isLiteral(iter.bytes[iter.head]) {
+			iter.head++
+		}
+		fallback = &kernel.Default{
+			Value: string(iter.bytes[start:iter.head]),
+		}
+		if fallback.Value == "null" {
+			fallback = &kernel.Default{
+				Null: true,
+			}
+		}
+	default:
+		iter.ReportUnExpectedChar("ReadDefault", c)
 	}
 	return
 }
 
+// checkDefault reports the default value which does not fit the node,
+// the default value of a container can only be null,
+// and the default value of a leaf node must be converted to its type.
+func (iter *Iterator) checkDefault(fallback *kernel.Default, dataType int, container bool, offset int) {
+	switch {
+	case fallback.Null:
+	case container:
+		iter.reportAt("ReadDefault", offset, "Only null can be the default value of containers")
+	default:
+		if err := kernel.NewGraphData("", dataType).Value(fallback.Value); err != nil {
+			iter.reportAt("ReadDefault", offset, fmt.Sprintf("Invalid default value, %s", err))
+		}
+	}
+}
+
+// isLiteral reports whether c can appear in an unquoted default value, such as -1.5e3 or true.
+func isLiteral(c byte) bool {
+	return signalValue[c] == SignalName || c == '.' || c == '-' || c == '+'
+}
+
 // ReadPipelines attempts to read pipelines from the byte stream
 func (iter *Iterator) ReadPipelines() (pipelines pipeline.Pipelines) {
 	c := iter.nextToken()
@@ -72,9 +371,35 @@ func (iter *Iterator) ReadPipelines() (pipelines pipeline.Pipelines) {
 
 // ReadPipeline attempts to read pipeline from the byte stream
 func (iter *Iterator) ReadPipeline() *pipeline.Pipeline {
-	return &pipeline.Pipeline{
+	start := iter.head
+	conseq := &pipeline.Pipeline{
 		Name: iter.ReadFuncName(),
-		Args: iter.ReadStringTuple(),
+	}
+	conseq.Args, conseq.Exprs = iter.ReadStringTuple()
+	if conseq.Name == pipeline.RootFunc && len(conseq.Args) > 0 &&
+		(len(conseq.Args) > 1 || conseq.Exprs == nil || conseq.Exprs[0] == nil) {
+		iter.recordAt("ReadPipeline", start, `The parameter of root is a pipeline, such as root(css("base"))`)
+	}
+	switch err := iter.processors().Check(conseq); {
+	case err == nil:
+	case iter.processors().Lookup(conseq.Name) == nil:
+		iter.recordAt("ReadPipeline", start, fmt.Sprintf(`Undefined method "%s"`, conseq.Name))
+	default:
+		iter.recordAt("ReadPipeline", start, "Invalid parameters, "+err.Error())
+	}
+	return conseq
+}
+
+// readExpr attempts to read the sub-pipeline of an argument, which is function calls separated by ";".
+func (iter *Iterator) readExpr() (pipelines pipeline.Pipelines) {
+	for {
+		iter.nextToken()
+		iter.unreadByte()
+		pipelines = append(pipelines, iter.ReadPipeline())
+		if iter.WhatIsNextByte() != ';' {
+			return
+		}
+		iter.head++
 	}
 }
 
@@ -82,48 +407,87 @@ func (iter *Iterator) ReadPipeline() *pipeline.Pipeline {
 func (iter *Iterator) ReadFuncName() (name string) {
 	for i := iter.head; i < iter.tail; i++ {
 		c := iter.bytes[i]
-		if c == '(' {
+		switch {
+		// the function name may be followed by whitespaces or comments before "("
+		case c == '(', c == ' ', c == '\n', c == '\t', c == '\r', iter.commentEnd(i) > i:
 			name = string(iter.bytes[iter.head:i])
 			iter.head = i
 			return
-		} else if signalValue[c] != SignalName {
-			iter.ReportUnExpectedChar("ReadFuncName", c)
+		case signalValue[c] != SignalName:
+			iter.reportUnexpectedAt("ReadFuncName", i, c)
 		}
 	}
 	return
 }
 
-// ReadStringTuple attempts to read function arguments from the byte stream
-func (iter *Iterator) ReadStringTuple() (args []string) {
+// ReadStringTuple attempts to read function arguments from the byte stream,
+// an argument is a quoted string or a sub-pipeline, such as `root(css("base");attr("href"))`.
+// exprs[i] is the sub-pipeline of args[i] and it is nil for a string argument,
+// exprs is nil when all the arguments are strings.
+func (iter *Iterator) ReadStringTuple() (args []string, exprs []pipeline.Pipelines) {
 	c := iter.nextToken()
 	if c != '(' {
 		iter.ReportMismatchChar("ReadStringTuple", '(', c)
 	}
-Loop:
+	computed := false
 	for {
 		c = iter.nextToken()
-		switch c {
-		case ')':
-			return
-		case '"':
-			for i := iter.head; i < iter.tail; i++ {
-				c = iter.bytes[i]
-				if c == '"' && iter.bytes[i-1] != '\\' {
-					arg := strings.Replace(string(iter.bytes[iter.head:i]), `\"`, `"`, -1)
-					args = append(args, arg)
-					iter.head = i + 1
-					if c = iter.WhatIsNextByte(); c == ',' {
-						iter.head++
-					}
-					break
-				}
+		switch {
+		case c == ')':
+			if !computed {
+				exprs = nil
 			}
+			return
+		case c == '"':
+			args = append(args, iter.readString("ReadStringTuple"))
+			exprs = append(exprs, nil)
+		case signalValue[c] == SignalName:
+			iter.unreadByte()
+			args = append(args, "")
+			exprs = append(exprs, iter.readExpr())
+			computed = true
 		default:
 			iter.ReportUnExpectedChar("ReadStringTuple", c)
-			break Loop
+		}
+		if c = iter.WhatIsNextByte(); c == ',' {
+			iter.head++
 		}
 	}
-	return
+}
+
+// readString reads the rest of a quoted string whose opening quote has been read,
+// the string can span several lines.
+func (iter *Iterator) readString(operation string) string {
+	if end := iter.closingQuote(iter.head - 1); end >= 0 {
+		str := strings.Replace(string(iter.bytes[iter.head:end]), `\"`, `"`, -1)
+		iter.head = end + 1
+		return str
+	}
+	iter.reportAt(operation, iter.head-1, "Unterminated string")
+	return ""
+}
+
+// closingQuote returns the offset of the quote that closes the string opened at offset,
+// or -1 when the string is unterminated.
+func (iter *Iterator) closingQuote(offset int) int {
+	for i := offset + 1; i < iter.tail; i++ {
+		if iter.bytes[i] == '"' && iter.bytes[i-1] != '\\' {
+			return i
+		}
+	}
+	return -1
+}
+
+// stringEnd returns the end of the string opened at offset for the recovery,
+// an unterminated string has no end, so the recovery resumes at the end of its line.
+func (iter *Iterator) stringEnd(offset int) int {
+	if end := iter.closingQuote(offset); end >= 0 {
+		return end + 1
+	}
+	if eol := bytes.IndexByte(iter.bytes[offset:iter.tail], '\n'); eol >= 0 {
+		return offset + eol
+	}
+	return iter.tail
 }
 
 // ReadChildren attempts to read node children from the byte stream
@@ -25,10 +25,16 @@ func (iter *Iterator) ReadObject() (nodes []*kernel.GraphNode) {
 	}
 	for {
 		c = iter.nextToken()
-		if c == '}' {
+		switch c {
+		case '}':
+			iter.closing = iter.takeComments(kernel.CommentClosing)
 			return
+		case 0:
+			iter.ReportMismatchChar("ReadObject", '}', c)
 		}
 		iter.unreadByte()
-		nodes = append(nodes, iter.ReadNode())
+		if node := iter.ReadNodeRecovered('}'); node != nil {
+			nodes = append(nodes, node)
+		}
 	}
 }
@@ -0,0 +1,102 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package compiler
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Resolver is used to load the expression files imported by expressions.
+type Resolver interface {
+	// Resolve locates the file imported as name by the file from,
+	// from is empty for an expression which is not read from a file.
+	// It returns the path which identifies the file and the content of it.
+	Resolve(from string, name string) (file string, expr []byte, err error)
+}
+
+const (
+	// ErrOutsideRoot means an imported file is not in the Root of the FileResolver
+	ErrOutsideRoot = "%s is outside the root %s"
+	// ErrAbsoluteImport means an absolute path is imported with a FileResolver
+	ErrAbsoluteImport = "absolute path %s is not allowed, the imports are resolved in the root %s"
+)
+
+// FileResolver is a Resolver which loads files from the filesystem,
+// a relative import is resolved from the directory of the importing file,
+// or from Root when the importing expression is not read from a file.
+// The files outside Root can not be imported, nor can the absolute paths.
+type FileResolver struct {
+	Root string
+}
+
+var _ Resolver = &FileResolver{}
+
+// NewFileResolver creates a FileResolver with the root directory.
+func NewFileResolver(root string) *FileResolver {
+	return &FileResolver{
+		Root: root,
+	}
+}
+
+// Resolve implements the Resolver interface.
+func (resolver *FileResolver) Resolve(from string, name string) (string, []byte, error) {
+	file := filepath.FromSlash(name)
+	if filepath.IsAbs(file) || path.IsAbs(name) {
+		return "", nil, fmt.Errorf(ErrAbsoluteImport, name, resolver.Root)
+	}
+	dir := resolver.Root
+	if from != "" {
+		dir = filepath.Dir(from)
+	}
+	file = filepath.Join(dir, file)
+	// the path is checked after it is cleaned by Join, so that ".." can not leave Root
+	if rel, err := filepath.Rel(filepath.Clean(resolver.Root), file); err != nil ||
+		rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", nil, fmt.Errorf(ErrOutsideRoot, name, resolver.Root)
+	}
+	expr, err := os.ReadFile(file)
+	return file, expr, err
+}
+
+// FSResolver is a Resolver which loads files from a fs.FS, such as an embed.FS,
+// a relative import is resolved from the directory of the importing file,
+// and an absolute import is resolved from the root of the FS.
+type FSResolver struct {
+	FS fs.FS
+}
+
+var _ Resolver = &FSResolver{}
+
+// NewFSResolver creates a FSResolver with the fsys.
+func NewFSResolver(fsys fs.FS) *FSResolver {
+	return &FSResolver{
+		FS: fsys,
+	}
+}
+
+// Resolve implements the Resolver interface.
+func (resolver *FSResolver) Resolve(from string, name string) (string, []byte, error) {
+	file := name
+	if !path.IsAbs(file) {
+		file = path.Join(path.Dir(from), file)
+	}
+	file = strings.TrimPrefix(path.Clean(file), "/")
+	expr, err := fs.ReadFile(resolver.FS, file)
+	return file, expr, err
+}
@@ -0,0 +1,173 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testFS = fstest.MapFS{
+	"common/price.gq": {Data: []byte(strings.Join([]string{
+		"import \"currency.gq\"",
+		"fragment Price {",
+		"    amount:float `css(\".amount\")`",
+		"    ...Currency",
+		"}",
+	}, "\n"))},
+	"common/currency.gq": {Data: []byte("fragment Currency { currency `css(\".currency\")` }")},
+	"common/crumbs.gq":   {Data: []byte("{ crumbs `css(\".crumb\")` [ crumb `text()` ] }")},
+	"sites/shop.gq": {Data: []byte(strings.Join([]string{
+		"import \"../common/price.gq\"",
+		"import \"/common/crumbs.gq\" as Crumbs",
+		"{",
+		"    ...Crumbs",
+		"    price `css(\".price\")` { ...Price }",
+		"}",
+	}, "\n"))},
+	"cycle/a.gq":   {Data: []byte("import \"b.gq\"\n{ a `text()` }")},
+	"cycle/b.gq":   {Data: []byte("import \"a.gq\"\n{ b `text()` }")},
+	"broken/a.gq":  {Data: []byte("import \"b.gq\"\n{ a `text()` }")},
+	"broken/b.gq":  {Data: []byte("import \"missing.gq\"\nfragment B { b- `text()` }")},
+	"currency.gq":  {Data: []byte("fragment Currency { code `text()` }")},
+	"redefined.gq": {Data: []byte("import \"currency.gq\"\nfragment Currency { c `text()` }\n{ a `text()` }")},
+}
+
+func TestCompileFile(t *testing.T) {
+	graph, err := CompileFile(NewFSResolver(testFS), "sites/shop.gq")
+	if err != nil {
+		t.Fatalf("CompileFile() error = %v", err)
+	}
+	var got []string
+	for _, node := range graph.Nodes {
+		got = append(got, fmt.Sprintf("%s %s %d", node.Fragment, node.Name, len(node.Children)))
+	}
+	for _, node := range graph.Nodes[1].Children {
+		got = append(got, fmt.Sprintf("%s %s %d", node.Fragment, node.Name, len(node.Children)))
+	}
+	want := []string{
+		"Crumbs crumbs 1",
+		" price 2",
+		"Price amount 0",
+		"Price currency 0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CompileFile() nodes = %q, want %q", got, want)
+	}
+	wantFormat := strings.Join([]string{
+		"import \"../common/price.gq\"",
+		"import \"/common/crumbs.gq\" as Crumbs",
+		"",
+		"{",
+		"    ...Crumbs",
+		"    price `css(\".price\")` {",
+		"        ...Price",
+		"    }",
+		"}",
+		"",
+	}, "\n")
+	if got := graph.String(); got != wantFormat {
+		t.Errorf("Graph.String() = %s, want %s", got, wantFormat)
+	}
+}
+
+func TestCompileFile_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want []string
+	}{
+		{
+			name: "test0",
+			file: "cycle/a.gq",
+			want: []string{
+				`cycle/b.gq 1:8 ReadImport: Import cycle: cycle/a.gq -> cycle/b.gq -> cycle/a.gq`,
+			},
+		},
+		{
+			name: "test1",
+			file: "broken/a.gq",
+			want: []string{
+				`broken/b.gq 1:8 ReadImport: Failed to import "missing.gq": open broken/missing.gq: file does not exist, import chain: broken/a.gq -> broken/b.gq -> broken/missing.gq`,
+				`broken/b.gq 2:15 ReadNodeName: Unexpected character "-"`,
+			},
+		},
+		{
+			name: "test2",
+			file: "redefined.gq",
+			want: []string{
+				` 2:10 ReadFragment: Fragment "Currency" is redefined`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		_, err := CompileFile(NewFSResolver(testFS), tt.file)
+		var got []string
+		if errs, ok := err.(CompileErrors); ok {
+			for _, e := range errs {
+				got = append(got, fmt.Sprintf("%s %d:%d %s: %s", e.File, e.Line, e.Column, e.Operation, e.Message))
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q. CompileFile() errors = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if _, err := CompileFile(NewFSResolver(testFS), "none.gq"); err == nil {
+		t.Errorf("CompileFile() error = nil, want the error of a missing file")
+	}
+	if _, err := Compile([]byte("import \"currency.gq\"\n{ a `text()` }")); err == nil ||
+		!strings.Contains(err.Error(), `Failed to import "currency.gq": no resolver is set`) {
+		t.Errorf("Compile() error = %v, want the error of no resolver", err)
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "common"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"common/price.gq": "fragment Price { amount:float `css(\".amount\")` }",
+		"shop.gq":         "import \"common/price.gq\"\n{ price `css(\".price\")` { ...Price } }",
+	}
+	for name, expr := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(expr), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolver := NewFileResolver(root)
+	graph, err := CompileFile(resolver, "shop.gq")
+	if err != nil {
+		t.Fatalf("CompileFile() error = %v", err)
+	}
+	if got := graph.Nodes[0].Children[0].Name; got != "amount" {
+		t.Errorf("CompileFile() child = %v, want amount", got)
+	}
+	graph, err = Compile([]byte(files["shop.gq"]), WithResolver(resolver))
+	if err != nil || len(graph.Nodes[0].Children) != 1 {
+		t.Errorf("Compile() = %v, %v, want the fragment spread", graph, err)
+	}
+
+	// the files outside the root can not be imported
+	secret := filepath.Join(filepath.Dir(root), "secret.txt")
+	if err := os.WriteFile(secret, []byte("root:x:0:0:root:/root:/bin/bash"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secret)
+	for _, name := range []string{"../secret.txt", "common/../../secret.txt", filepath.ToSlash(secret)} {
+		_, err := Compile([]byte("import \""+name+"\""), WithResolver(resolver))
+		if err == nil || strings.Contains(err.Error(), "root:x") || !strings.Contains(err.Error(), "Failed to import") {
+			t.Errorf("Compile() of %s error = %v, want a failed import", name, err)
+		}
+	}
+	// the content of an imported file which is not an expression is not quoted
+	if err := os.WriteFile(filepath.Join(root, "passwd"), []byte("root:x:0:0:root:/root:/bin/bash"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Compile([]byte("import \"passwd\""), WithResolver(resolver)); err == nil || strings.Contains(err.Error(), "root:x") {
+		t.Errorf("Compile() error = %v, want the error without the content of the file", err)
+	}
+}
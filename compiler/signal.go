@@ -24,6 +24,8 @@ const (
 	SignalObject
 	// SignalArray identifies the beginning of the array
 	SignalArray
+	// SignalString identifies the beginning of the quoted string
+	SignalString
 )
 
 // SignalType is the signal value type
@@ -46,4 +48,5 @@ func init() {
 	signalValue['['] = SignalArray
 	signalValue['{'] = SignalObject
 	signalValue['`'] = SignalPipeline
+	signalValue['"'] = SignalString
 }
@@ -15,6 +15,7 @@
 package graphquery
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/storyicon/graphquery/compiler"
@@ -24,14 +25,15 @@ import (
 // Response is an alias for kernel.GraphResponse
 type Response = kernel.GraphResponse
 
-// Compile compiles an expression in the form of a byte array into a parser
-func Compile(expr []byte) (*kernel.Graph, error) {
-	return compiler.Compile(expr)
+// Compile compiles an expression in the form of a byte array into a parser,
+// options such as compiler.WithRegistry are applied to the compiling.
+func Compile(expr []byte, options ...compiler.Option) (*kernel.Graph, error) {
+	return compiler.Compile(expr, options...)
 }
 
 // MustCompile is used to compile expressions, will panic when compile errors
-func MustCompile(expr []byte) *kernel.Graph {
-	parser, err := compiler.Compile(expr)
+func MustCompile(expr []byte, options ...compiler.Option) *kernel.Graph {
+	parser, err := compiler.Compile(expr, options...)
 	if err == nil {
 		return parser
 	}
@@ -47,13 +49,39 @@ func ParseFromString(document string, expr string) (response *Response) {
 // ParseFromBytes is used to parse documents in string format and expressions in []byte form
 // errors will be recorded in the Errors of Response
 func ParseFromBytes(document string, expr []byte) (response *Response) {
-	parser, err := Compile(expr)
+	return ParseContext(context.Background(), document, string(expr))
+}
+
+// ParseContext is like ParseFromString, but the parsing stops when ctx is cancelled or expired,
+// the data parsed so far is returned and the reason is recorded in the Errors of Response.
+// options such as kernel.WithLimits are applied to the parse.
+func ParseContext(ctx context.Context, document string, expr string, options ...kernel.Option) (response *Response) {
+	parser, err := Compile([]byte(expr))
 	response = &Response{}
 	if err != nil {
-		response.Errors = append(response.Errors, &kernel.Error{
-			Err: fmt.Sprintf("--- Compile Error: %s", err),
-		})
+		response.Errors = compileErrors(err)
 		return
 	}
-	return parser.Parse(document)
+	return parser.ParseContext(ctx, document, options...)
+}
+
+// compileErrors converts the error of Compile to kernel.Errors,
+// every syntax error takes one Error with the *compiler.CompileError as its Detail.
+func compileErrors(err error) (errs kernel.Errors) {
+	details, ok := err.(compiler.CompileErrors)
+	if !ok {
+		return kernel.Errors{
+			{
+				Err:    fmt.Sprintf("--- Compile Error: %s", err),
+				Detail: err,
+			},
+		}
+	}
+	for _, detail := range details {
+		errs = append(errs, &kernel.Error{
+			Err:    fmt.Sprintf("--- Compile Error: %s", detail),
+			Detail: detail,
+		})
+	}
+	return
 }
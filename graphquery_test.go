@@ -1,12 +1,20 @@
 package graphquery
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 
+	"github.com/storyicon/graphquery/compiler"
 	"github.com/storyicon/graphquery/kernel"
+	"github.com/storyicon/graphquery/kernel/pipeline"
+	"github.com/storyicon/graphquery/kernel/selector"
 )
 
 func TestParseFromString(t *testing.T) {
@@ -217,6 +225,83 @@ func TestParseFromString(t *testing.T) {
 			},
 			wantResponse: `{"data":[{"title":"Page 1","url":"01.html"},{"title":"Page 2","url":"02.html"},{"title":"Page 3","url":"03.html"}],"errors":null}`,
 		},
+		{
+			name: "test8",
+			args: args{
+				document: `
+                    <html>
+                        <body>
+                            <a href="01.html">Page 1</a>
+                            <a href="02.html">Page 2</a>
+                        </body>
+                    </html>
+                `,
+				expr: strings.Join([]string{
+					"// anchors of the page",
+					"anchor `xpath(\"//a\") /* every anchor */` [{",
+					"    title `text()` // the text",
+					"    /* the link */ url `attr(\"href\")`",
+					"}]",
+				}, "\r\n"),
+			},
+			wantResponse: `{"data":[{"title":"Page 1","url":"01.html"},{"title":"Page 2","url":"02.html"}],"errors":null}`,
+		},
+		{
+			name: "test9",
+			args: args{
+				document: `
+                    <div class="item"><b class="price"> 9.5 </b><b class="count">3</b><b class="stock">true</b></div>
+                    <div class="item"><b class="price"></b><b class="count">many</b><b class="stock">false</b></div>
+                `,
+				expr: strings.Join([]string{
+					"item `css(\".item\")` [{",
+					"    price:float `css(\".price\")`",
+					"    count:int `css(\".count\")`",
+					"    inStock:bool `css(\".stock\")`",
+					"    name:string `css(\".name\")`",
+					"}]",
+				}, "\n"),
+			},
+			wantResponse: `{"data":[{"count":3,"inStock":true,"name":"","price":9.5},{"count":null,"inStock":false,"name":"","price":null}],"errors":["count: can not convert \"many\" to int"]}`,
+		},
+		{
+			name: "test10",
+			args: args{
+				document: `<a href="1.html" id="a1">anchor 1</a>`,
+				expr: strings.Join([]string{
+					"{",
+					"    \"@type\" `template(\"Anchor\")`",
+					"    id as \"product-id\" `css(\"a\");attr(\"id\")`",
+					"    title as \"标题\" `css(\"a\");text()`",
+					"    url as \"meta.url\" `css(\"a\");attr(\"href\");template(\"{$id}/{$}\")`",
+					"}",
+				}, "\n"),
+			},
+			wantResponse: `{"data":{"@type":"Anchor","meta.url":"a1/1.html","product-id":"a1","标题":"anchor 1"},"errors":null}`,
+		},
+		{
+			name: "test11",
+			args: args{
+				document: `
+                    <div class="price"><i class="amount">10</i><i class="currency">USD</i></div>
+                    <div class="item"><b>A</b><i class="amount">1.5</i><i class="currency">EUR</i></div>
+                `,
+				expr: strings.Join([]string{
+					"fragment Price {",
+					"    amount:float `css(\".amount\")`",
+					"    currency `css(\".currency\")`",
+					"}",
+					"{",
+					"    price `css(\".price\")` { ...Price }",
+					"    items `css(\".item\")` [{",
+					"        name `css(\"b\")`",
+					"        ...Price",
+					"    }]",
+					"}",
+				}, "\n"),
+			},
+			wantResponse: `{"data":{"items":[{"amount":1.5,"currency":"EUR","name":"A"}],"price":{"amount":10,"currency":"USD"}},"errors":null}`,
+		},
 	}
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	for _, tt := range tests {
@@ -300,3 +385,579 @@ func TestParseFromBytes(t *testing.T) {
 		}
 	}
 }
+
+func TestParseFromBytes_CompileError(t *testing.T) {
+	response := ParseFromBytes(`<a href="1.html">anchor 1</a>`, []byte("{\n    a `css(\"a\")` [{ title `text()` }\n}"))
+	if len(response.Errors) != 1 {
+		t.Fatalf("ParseFromBytes() errors = %v, want 1 error", response.Errors)
+	}
+	err, ok := response.Errors[0].Detail.(*compiler.CompileError)
+	if !ok {
+		t.Fatalf("ParseFromBytes() error detail = %#v, want a *compiler.CompileError", response.Errors[0].Detail)
+	}
+	if err.Operation != "ReadObjectArray" || err.Line != 3 || err.Column != 1 || err.Expected != "]" || err.Actual != "}" {
+		t.Errorf("ParseFromBytes() error detail = %#v", err)
+	}
+	if want := "--- Compile Error: " + err.Error(); response.Errors[0].Error() != want {
+		t.Errorf("ParseFromBytes() error = %v, want %v", response.Errors[0], want)
+	}
+}
+
+func TestLoadGraph(t *testing.T) {
+	exprs := []string{
+		"a `css(\"a\")` [{ title `text();trim()` url  `attr(\"href\")` }]",
+		"// books\n{ title `css(\"title\")` // trailing\n items `xpath(\"//item\")` [ name `text()` ] \"@id\" as id `attr(\"id\")` price:float `text()` author `css(\"author\")` {} }",
+		"fragment Price { amount:float `css(\".amount\")` }\n{ price `css(\".price\")` { ...Price } }",
+	}
+	for _, expr := range exprs {
+		graph := MustCompile([]byte(expr))
+		data, err := json.Marshal(graph)
+		if err != nil {
+			t.Errorf("%q. json.Marshal() error = %v", expr, err)
+			continue
+		}
+		got, err := kernel.LoadGraph(data)
+		if err != nil {
+			t.Errorf("%q. kernel.LoadGraph() error = %v", expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, graph) {
+			t.Errorf("%q. kernel.LoadGraph() = %s, want %s", expr, got, graph)
+		}
+	}
+}
+
+func TestParseContext_Defaults(t *testing.T) {
+	document := `
+        <div class="item"><b class="price">3</b><i>new</i></div>
+        <div class="item"><b class="price">n/a</b></div>
+    `
+	expr := strings.Join([]string{
+		"{",
+		"    currency `css(\".currency\")` ?? \"USD\"",
+		"    items `css(\".item\")` [{",
+		"        price:int `css(\".price\")` ?? -1",
+		"        note `css(\"i\")` ?? null",
+		"    }]",
+		"    tags `css(\".tag\")` ?? null [ tag `text()` ]",
+		"}",
+	}, "\n")
+	tests := []struct {
+		name    string
+		options []kernel.Option
+		want    string
+	}{
+		{
+			name: "test0",
+			want: `{"data":{"currency":"USD","items":[{"note":"new","price":3},{"note":null,"price":null}],"tags":null},"errors":["price: can not convert \"n/a\" to int"],"defaults":["currency","items[1].note","tags"]}`,
+		},
+		{
+			name:    "test1",
+			options: []kernel.Option{kernel.WithFallback()},
+			want:    `{"data":{"currency":"USD","items":[{"note":"new","price":3},{"note":null,"price":-1}],"tags":null},"errors":["price: can not convert \"n/a\" to int"],"defaults":["currency","items[1].price","items[1].note","tags"]}`,
+		},
+	}
+	for _, tt := range tests {
+		if got := ParseContext(context.Background(), document, expr, tt.options...).JSON(); got != tt.want {
+			t.Errorf("%q. ParseContext() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseContext_Required(t *testing.T) {
+	document := `
+        <h1> </h1>
+        <div class="item"><b class="price">3</b><i>new</i></div>
+        <div class="item"><b class="price">n/a</b></div>
+    `
+	expr := strings.Join([]string{
+		"{",
+		"    title! `css(\"h1\")`",
+		"    items! `css(\".item\")` [{",
+		"        price:int! `css(\".price\")`",
+		"        note! `css(\"i\")` ?? \"none\"",
+		"    }]",
+		"    tags! `css(\".tag\")` [ tag `text()` ]",
+		"}",
+	}, "\n")
+	tests := []struct {
+		name    string
+		options []kernel.Option
+		want    string
+		paths   []string
+	}{
+		{
+			name:  "test0",
+			want:  `{"data":{"items":[{"note":"new","price":3},{"note":"none","price":null}],"tags":null,"title":" "},"errors":["required node \"title\" is empty","required node \"items[1].price\" is failed","required node \"tags\" is empty","price: can not convert \"n/a\" to int"],"defaults":["items[1].note"]}`,
+			paths: []string{"title", "items[1].price", "tags"},
+		},
+		{
+			name:    "test1",
+			options: []kernel.Option{kernel.WithStrict()},
+			want:    `{"data":null,"errors":["required node \"title\" is empty","required node \"items[1].price\" is failed","required node \"tags\" is empty","price: can not convert \"n/a\" to int"],"defaults":["items[1].note"]}`,
+			paths:   []string{"title", "items[1].price", "tags"},
+		},
+	}
+	for _, tt := range tests {
+		response := ParseContext(context.Background(), document, expr, tt.options...)
+		if got := response.JSON(); got != tt.want {
+			t.Errorf("%q. ParseContext() = %v, want %v", tt.name, got, tt.want)
+		}
+		var paths []string
+		for _, err := range response.Errors {
+			var validation *kernel.ValidationError
+			if errors.As(err, &validation) {
+				paths = append(paths, validation.Path)
+			}
+		}
+		if !reflect.DeepEqual(paths, tt.paths) {
+			t.Errorf("%q. ParseContext() validation paths = %v, want %v", tt.name, paths, tt.paths)
+		}
+	}
+
+	response := ParseContext(context.Background(), document, "{ title `css(\"h1\")` }", kernel.WithStrict())
+	if response.Data == nil {
+		t.Errorf("Parse() data = nil, want the data without required nodes")
+	}
+}
+
+func TestParseContext_Filter(t *testing.T) {
+	document := `
+        <div class="item"><b>Apple</b><i>3</i></div>
+        <div class="item"><b>Banana</b><i>0</i></div>
+        <div class="item"><b>Avocado</b><i>n/a</i></div>
+        <div class="item"><i>2</i></div>
+        <span class="tag">a</span><span class="tag">b</span><span class="tag">c</span>
+    `
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{
+			name: "test0",
+			expr: "{ items `css(\".item\")` [{ name `css(\"b\")` price:int `css(\"i\")` }] where (price > 0) }",
+			want: `{"data":{"items":[{"name":"Apple","price":3},{"name":"","price":2}]},"errors":["price: can not convert \"n/a\" to int"]}`,
+		},
+		{
+			name: "test1",
+			expr: "{ items `css(\".item\")` [{ name `css(\"b\")` price `css(\"i\")` }] where (name =~ \"^A\" && !(price == \"n/a\")) }",
+			want: `{"data":{"items":[{"name":"Apple","price":"3"}]},"errors":null}`,
+		},
+		{
+			name: "test2",
+			expr: "{ tags `css(\".tag\")` [ tag `text()` ] where (tag != \"b\") }",
+			want: `{"data":{"tags":["a","c"]},"errors":null}`,
+		},
+		{
+			name: "test3",
+			expr: "{ items `css(\".item\")` [{ name! `css(\"b\")` ?? \"unknown\" price:int `css(\"i\")` }] where (price == null || price < 3) }",
+			want: `{"data":{"items":[{"name":"Banana","price":0},{"name":"Avocado","price":null},{"name":"unknown","price":2}]},"errors":["price: can not convert \"n/a\" to int"],"defaults":["items[2].name"]}`,
+		},
+		{
+			name: "test4",
+			expr: "{ items `css(\".item\")` [{ name! `css(\"b\")` }] where (name) }",
+			want: `{"data":{"items":[{"name":"Apple"},{"name":"Banana"},{"name":"Avocado"}]},"errors":null}`,
+		},
+	}
+	for _, tt := range tests {
+		if got := ParseContext(context.Background(), document, tt.expr).JSON(); got != tt.want {
+			t.Errorf("%q. ParseContext() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseContext_List(t *testing.T) {
+	document := `
+        <div class="item"><b>item10</b><i>3</i></div>
+        <div class="item"><b>item2</b><i>12</i></div>
+        <div class="item"><b>item10</b><i>3</i></div>
+        <div class="item"><b>item1</b><i>n/a</i></div>
+        <div class="item"><b>item3</b><i>1.5</i></div>
+    `
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{
+			name: "test0",
+			expr: "{ items `css(\".item\")` [{ name `css(\"b\")` price `css(\"i\")` }] unique sort by price numeric }",
+			want: `{"data":{"items":[{"name":"item3","price":"1.5"},{"name":"item10","price":"3"},{"name":"item2","price":"12"},{"name":"item1","price":"n/a"}]},"errors":null}`,
+		},
+		{
+			name: "test1",
+			expr: "{ items `css(\".item\")` [{ name `css(\"b\")` price `css(\"i\")` }] sort by price desc }",
+			want: `{"data":{"items":[{"name":"item1","price":"n/a"},{"name":"item10","price":"3"},{"name":"item10","price":"3"},{"name":"item2","price":"12"},{"name":"item3","price":"1.5"}]},"errors":null}`,
+		},
+		{
+			name: "test2",
+			expr: "{ names `css(\"b\")` [ name `text()` ] unique sort natural }",
+			want: `{"data":{"names":["item1","item2","item3","item10"]},"errors":null}`,
+		},
+		{
+			name: "test3",
+			expr: "{ names `css(\"b\")` [ name `text()` ] reverse offset 1 limit 2 }",
+			want: `{"data":{"names":["item1","item10"]},"errors":null}`,
+		},
+		{
+			name: "test4",
+			expr: "{ items `css(\".item\")` [{ name `css(\"b\")` price:float! `css(\"i\")` }] unique by name offset 1 limit 2 }",
+			want: `{"data":{"items":[{"name":"item2","price":12},{"name":"item1","price":null}]},"errors":["required node \"items[1].price\" is failed","price: can not convert \"n/a\" to float"]}`,
+		},
+		{
+			// the sorted elements are recorded at their positions in the output, the dropped ones are not
+			name: "test5",
+			expr: "{ items `css(\".item\")` [{ name `css(\"b\")` note! `css(\"u\")` tag `css(\"s\")` ?? \"none\" price `css(\"i\")` }] sort by price numeric desc limit 1 }",
+			want: `{"data":{"items":[{"name":"item2","note":"","price":"12","tag":"none"}]},"errors":["required node \"items[0].note\" is empty"],"defaults":["items[0].tag"]}`,
+		},
+	}
+	for _, tt := range tests {
+		if got := ParseContext(context.Background(), document, tt.expr).JSON(); got != tt.want {
+			t.Errorf("%q. ParseContext() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseContext_Args(t *testing.T) {
+	document := `
+        <base href="https://example.com/docs/">
+        <h1>Graph Query Language</h1>
+        <a href="intro.html">Intro</a>
+        <a href="/api.html">API</a>
+        <span>-</span>
+    `
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{
+			name: "test0",
+			expr: "{ links `css(\"a\")` [ link `attr(\"href\");absolute(root(css(\"base\");attr(\"href\")))` ] }",
+			want: `{"data":{"links":["https://example.com/docs/intro.html","https://example.com/api.html"]},"errors":null}`,
+		},
+		{
+			name: "test1",
+			expr: "{ separator `css(\"span\")` title `css(\"h1\");text();replace(\" \", link(\"separator\"))` }",
+			want: `{"data":{"separator":"-","title":"Graph-Query-Language"},"errors":null}`,
+		},
+		{
+			name: "test2",
+			expr: "{ links `css(\"a\")` [ link `attr(\"href\");replace(\".html\", template(\"#{$}\"))` ] }",
+			want: `{"data":{"links":["intro#intro.html","/api#/api.html"]},"errors":null}`,
+		},
+		{
+			name: "test3",
+			expr: "{ document `css(\"a\");root()` { title `css(\"h1\")` } }",
+			want: `{"data":{"document":{"title":"Graph Query Language"}},"errors":null}`,
+		},
+	}
+	for _, tt := range tests {
+		if got := ParseContext(context.Background(), document, tt.expr).JSON(); got != tt.want {
+			t.Errorf("%q. ParseContext() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompile_Registry(t *testing.T) {
+	document := `<p>  GraphQuery  </p>`
+	sandbox := pipeline.Default.Clone()
+	sandbox.Deny("regex")
+	sandbox.Override("trim", &pipeline.Signature{}, func(node selector.Selection, args pipeline.Args) (selector.Selection, error) {
+		return selector.NewString("[" + strings.TrimSpace(node.Text()) + "]")
+	})
+	tests := []struct {
+		name     string
+		expr     string
+		registry *pipeline.Registry
+		want     string
+	}{
+		{
+			name: "test0",
+			expr: "{ title `css(\"p\");text();trim()` }",
+			want: `{"data":{"title":"GraphQuery"},"errors":null}`,
+		},
+		{
+			name:     "test1",
+			expr:     "{ title `css(\"p\");trim()` }",
+			registry: sandbox,
+			want:     `{"data":{"title":"[GraphQuery]"},"errors":null}`,
+		},
+		{
+			name:     "test2",
+			expr:     "{ title `regex(\"Graph\")` }",
+			registry: sandbox,
+			want:     `{"data":null,"errors":["--- Compile Error: ReadPipeline: Undefined method \"regex\", error found in #9 byte of ...|{ title ` + "`" + `regex(\"Gra|..., bigger context ...|{ title ` + "`" + `regex(\"Graph\")` + "`" + ` }|... "]}`,
+		},
+	}
+	for _, tt := range tests {
+		response := &Response{}
+		if graph, err := Compile([]byte(tt.expr), compiler.WithRegistry(tt.registry)); err != nil {
+			response.Errors = compileErrors(err)
+		} else {
+			response = graph.Parse(document)
+		}
+		if got := response.JSON(); got != tt.want {
+			t.Errorf("%q. Compile() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if pipeline.Default.Lookup("regex") == nil {
+		t.Errorf("Registry.Deny() changes the registry cloned")
+	}
+}
+
+func TestParseContext_MixedSelectors(t *testing.T) {
+	document := `
+        <div class="item"><a href="/a">A1</a><p>P1</p></div>
+        <div class="item"><a href="/b">A2</a><div class="in">in</div></div>
+    `
+	// the selectors after a switch between css() and xpath() select what they select
+	// from the document parsed from the HTML of the elements, as the selections did when they were parsed again
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{
+			name: "test0",
+			expr: "{ items `css(\"div.item\")` [{ name `xpath(\"./a\")` link `xpath(\".\");css(\"a\");attr(\"href\")` count `xpath(\"./p\");text()` }] }",
+			want: `{"data":{"items":[{"count":"","link":"/a","name":""},{"count":"","link":"/b","name":""}]},"errors":null}`,
+		},
+		{
+			name: "test1",
+			expr: "{ links `xpath(\"//div\");css(\"a\")` [ link `attr(\"href\")` ] }",
+			want: `{"data":{"links":["/a","/b"]},"errors":null}`,
+		},
+		{
+			name: "test2",
+			expr: "{ items `css(\"div.item\")` [ item `xpath(\"/html/body\");text()` ] links `css(\"div.item\");xpath(\"//a\")` [ link `attr(\"href\")` ] }",
+			want: `{"data":{"items":["A1P1","A2in"],"links":["/a","/b"]},"errors":null}`,
+		},
+		{
+			name: "test3",
+			expr: "{ text `css(\".item\");xpath(\".//div\")` }",
+			want: `{"data":{"text":"A1P1A2inin"},"errors":null}`,
+		},
+		{
+			name: "test4",
+			expr: "{ anchors `xpath(\"//a\")` [{ self `css(\"a\")` all `css(\"*\")` }] }",
+			want: `{"data":{"anchors":[{"all":"A1A1","self":"A1"},{"all":"A2A2","self":"A2"}]},"errors":null}`,
+		},
+		{
+			name: "test5",
+			expr: "{ divs `xpath(\"//div\")` [ div `css(\"div\")` ] }",
+			want: `{"data":{"divs":["A1P1","A2inin","in"]},"errors":null}`,
+		},
+		{
+			name: "test6",
+			expr: "{ items `css(\".item\")` [ a `xpath(\"./a\")` ] hrefs `css(\"a\")` [ href `xpath(\"@href\")` ] }",
+			want: `{"data":{"hrefs":["",""],"items":["",""]},"errors":null}`,
+		},
+		{
+			name: "test7",
+			expr: "{ anchors `css(\"a\")` [ parent `xpath(\"//a\");xpath(\"..\")` ] }",
+			want: `{"data":{"anchors":["A1","A2"]},"errors":null}`,
+		},
+	}
+	for _, tt := range tests {
+		if got := ParseContext(context.Background(), document, tt.expr).JSON(); got != tt.want {
+			t.Errorf("%q. ParseContext() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	html := `<div class="item"><a href="/a">A</a></div><div class="item"><a href="/b">B</a></div>`
+	tests := []struct {
+		name     string
+		document string
+		expr     string
+		want     string
+	}{
+		{
+			name:     "test0",
+			document: html,
+			expr:     "{ links `css(\"a\")` [ link `attr(\"href\")` ] names `xpath(\"//a\")` [ name `text()` ] }",
+			want:     `{"data":{"links":["/a","/b"],"names":["A","B"]},"errors":null}`,
+		},
+		{
+			name:     "test1",
+			document: html,
+			expr:     "{ links `css(\"a\")` [ link `attr(\"href\")` ] first `regex(\"href=\\\"(.*?)\\\"\")` }",
+			want:     `{"data":{"first":"/a/b","links":["/a","/b"]},"errors":null}`,
+		},
+		{
+			name:     "test2",
+			document: "{\n    \"title\": \"graph query\",\n    \"items\": [ {\"id\": 1}, {\"id\": 2} ]\n}",
+			expr:     "{ title `json(\"title\")` ids `json(\"items.#.id\")` [ id:int `` ] items `json(\"items\")` }",
+			want:     `{"data":{"ids":[1,2],"items":"[ {\"id\": 1}, {\"id\": 2} ]","title":"graph query"},"errors":null}`,
+		},
+		{
+			name:     "test3",
+			document: html,
+			expr:     "{ title `css(\"a\");root(css(\"div\");text())` }",
+			want:     `{"data":{"title":"AB"},"errors":null}`,
+		},
+	}
+	for _, tt := range tests {
+		graph, err := Compile([]byte(tt.expr))
+		if err != nil {
+			t.Errorf("%q. Compile() error = %v", tt.name, err)
+			continue
+		}
+		if got := graph.ParseReader(strings.NewReader(tt.document)).JSON(); got != tt.want {
+			t.Errorf("%q. Graph.ParseReader() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	graph := MustCompile([]byte("{ title `css(\"title\")` }"))
+	if got, want := graph.ParseReader(iotest.ErrReader(errors.New("broken pipe"))).Errors.Errors(), []string{"read document failed: broken pipe"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Graph.ParseReader() errors = %v, want %v", got, want)
+	}
+}
+
+func TestParseReader_Parse(t *testing.T) {
+	html := `<html><head><title>T</title></head><body><div class="item"><a href="/a">A</a></div><div class="item"><a href="/b">B</a></div></body></html>`
+	json := "{\n    \"title\": \"graph query\",\n    \"items\": [ {\"id\": 1}, {\"id\": 2} ]\n}"
+	tests := []struct {
+		name     string
+		document string
+		expr     string
+	}{
+		{
+			name:     "test0",
+			document: html,
+			expr:     "{ a `css(\"title\")` b `xpath(\"/html/head/title\")` }",
+		},
+		{
+			name:     "test1",
+			document: html,
+			expr:     "{ html `css(\"html\")` body `xpath(\"/html/body\")` links `xpath(\"//a\")` [ link `attr(\"href\")` ] }",
+		},
+		{
+			name:     "test2",
+			document: html,
+			expr:     "{ items `css(\"div.item\")` [ item `xpath(\"/html/body\");text()` ] title `css(\"a\");root(xpath(\"//title\");text())` }",
+		},
+		{
+			name:     "test3",
+			document: json,
+			expr:     "{ title `json(\"title\")` ids `json(\"items.#.id\")` [ id:int `` ] items `json(\"items\")` first `json(\"items.0\")` }",
+		},
+	}
+	for _, tt := range tests {
+		graph, err := Compile([]byte(tt.expr))
+		if err != nil {
+			t.Errorf("%q. Compile() error = %v", tt.name, err)
+			continue
+		}
+		want := graph.Parse(tt.document).JSON()
+		if got := graph.ParseReader(strings.NewReader(tt.document)).JSON(); got != want {
+			t.Errorf("%q. Graph.ParseReader() = %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestGraph_Stream(t *testing.T) {
+	document := `
+        <div class="page"><a href="/a">A</a><a href="/b">B</a></div>
+        <div class="page"><a href="/c">C</a></div>
+    `
+	stop := errors.New("enough")
+	tests := []struct {
+		name    string
+		expr    string
+		path    []string
+		stopAt  int
+		want    []string
+		wantErr error
+		data    string
+	}{
+		{
+			name: "test0",
+			expr: "{ title `css(\"a\");eq(\"0\");text()` links `css(\"a\")` [{ name `text()` url `attr(\"href\")` }] }",
+			path: []string{"links"},
+			want: []string{`{"name":"A","url":"/a"}`, `{"name":"B","url":"/b"}`, `{"name":"C","url":"/c"}`},
+			data: `{"links":[],"title":"A"}`,
+		},
+		{
+			name: "test1",
+			expr: "{ pages `css(\".page\")` [{ urls `css(\"a\")` [ url `attr(\"href\")` ] sort desc }] }",
+			path: []string{"pages", "urls"},
+			want: []string{`"/b"`, `"/a"`, `"/c"`},
+			data: `{"pages":[{"urls":null},{"urls":null}]}`,
+		},
+		{
+			name:    "test2",
+			expr:    "{ links `css(\"a\")` [ url `attr(\"href\")` ] }",
+			path:    []string{"links"},
+			stopAt:  2,
+			want:    []string{`"/a"`, `"/b"`},
+			wantErr: stop,
+			data:    `{"links":null}`,
+		},
+		{
+			// the keys are not split, so they can contain dots
+			name: "test3",
+			expr: "{ \"page.links\" `css(\".page\")` [{ \"a.url\" as url `css(\"a\");attr(\"href\")` }] }",
+			path: []string{"page.links"},
+			want: []string{`{"url":"/a"}`, `{"url":"/c"}`},
+			data: `{"page.links":[]}`,
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		response, err := MustCompile([]byte(tt.expr)).Stream(document, tt.path, func(item kernel.GraphRawData) error {
+			conseq, _ := json.Marshal(item)
+			got = append(got, string(conseq))
+			if len(got) == tt.stopAt {
+				return stop
+			}
+			return nil
+		})
+		if err != tt.wantErr {
+			t.Errorf("%q. Graph.Stream() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q. Graph.Stream() items = %v, want %v", tt.name, got, tt.want)
+		}
+		if data, _ := response.MarshalData(); string(data) != tt.data {
+			t.Errorf("%q. Graph.Stream() data = %s, want %v", tt.name, data, tt.data)
+		}
+	}
+	if _, err := MustCompile([]byte("{ title `css(\"title\")` }")).Stream(document, []string{"title"}, nil); err == nil || err.Error() != `can not stream ["title"], it is not the path of an array node` {
+		t.Errorf("Graph.Stream() error = %v", err)
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	graph := MustCompile([]byte("{ title! `css(\"title\");text()` }"))
+	documents := make([]string, 24)
+	for i := range documents {
+		documents[i] = fmt.Sprintf("<title>page%d</title>", i)
+	}
+	response := ParseBatch(graph, documents, BatchOptions{Workers: 4})
+	for i, result := range response.Results {
+		if got, want := result.Response.JSON(), fmt.Sprintf(`{"data":{"title":"page%d"},"errors":null}`, i); got != want {
+			t.Errorf("ParseBatch() result %d = %v, want %v", i, got, want)
+		}
+	}
+	if response.Failed != 0 || response.Skipped != 0 || response.Total < response.Max {
+		t.Errorf("ParseBatch() = %+v", response)
+	}
+
+	documents[2] = "<p>page2</p>"
+	response = ParseBatch(graph, documents, BatchOptions{Workers: 1, FailFast: true})
+	if response.Failed != 22 || response.Skipped != 21 {
+		t.Errorf("ParseBatch() failed = %d, skipped = %d, want 22, 21", response.Failed, response.Skipped)
+	}
+	for i, want := range []string{
+		`{"data":{"title":"page1"},"errors":null}`,
+		`{"data":{"title":""},"errors":["required node \"title\" is empty"]}`,
+		`{"data":null,"errors":["document skipped: another document failed"]}`,
+	} {
+		if got := response.Results[i+1].Response.JSON(); got != want {
+			t.Errorf("ParseBatch() result %d = %v, want %v", i+1, got, want)
+		}
+	}
+}
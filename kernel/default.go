@@ -0,0 +1,78 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/storyicon/graphquery/kernel/selector"
+)
+
+// WithFallback makes the default values of nodes also apply when their pipelines fail
+// or their values can not be converted, not only when they are empty.
+// The errors are still recorded in GraphResponse.Errors.
+func WithFallback() Option {
+	return func(exec *execution) {
+		exec.fallback = true
+	}
+}
+
+// useDefault reports whether the default value of the node is used,
+// empty reports whether the node is empty and invalid reports whether its value can not be converted.
+func (s *scope) useDefault(empty bool, invalid bool) bool {
+	if s.node.Default == nil {
+		return false
+	}
+	return empty || s.exec.fallback && (invalid || s.failed)
+}
+
+// defaultData returns the default value of the node and records its path in the execution.
+func (s *scope) defaultData() *GraphData {
+	conseq := NewGraphData(s.node.Key(), s.node.NodeType)
+	if s.node.Default.Null {
+		conseq.Dnull = true
+	} else if err := conseq.Value(s.node.Default.Value); err != nil {
+		s.addError(err)
+	}
+	s.exec.defaults = append(s.exec.defaults, s.path())
+	return conseq
+}
+
+// path returns the path of the scope in the output, such as "items[0].price".
+func (s *scope) path() string {
+	var keys []string
+	for current := s; current != nil && current.parent != nil; current = current.parent {
+		key := current.node.Key()
+		if current.indexed {
+			key = fmt.Sprintf("%s[%d]", key, current.index)
+		}
+		keys = append([]string{key}, keys...)
+	}
+	return strings.Join(keys, ".")
+}
+
+// isEmpty reports whether the selection has no elements.
+func isEmpty(selection selector.Selection) bool {
+	if selection == nil {
+		return true
+	}
+	empty := true
+	selection.Each(func(int, selector.Selection) bool {
+		empty = false
+		return false
+	})
+	return empty
+}
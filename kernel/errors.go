@@ -25,6 +25,9 @@ type H map[string]interface{}
 // Error represents a error's specification.
 type Error struct {
 	Err string `json:"error"`
+	// Detail is the structured error behind Err if there is one,
+	// such as a *compiler.CompileError.
+	Detail error `json:"-"`
 }
 
 // Errors is a collection of Error
@@ -47,6 +50,11 @@ func (msg Error) Error() string {
 	return msg.Err
 }
 
+// Unwrap returns the Detail of Error, so that errors.As can reach it.
+func (msg Error) Unwrap() error {
+	return msg.Detail
+}
+
 // Errors returns an array will all the error messages.
 // Example:
 // 		c.Error(errors.New("first"))
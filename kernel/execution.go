@@ -0,0 +1,262 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/storyicon/graphquery/kernel/pipeline"
+	"github.com/storyicon/graphquery/kernel/selector"
+)
+
+// execution holds the state of a single parse of a Graph.
+// It is created for every call and is never shared between goroutines.
+type execution struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	graph  *Graph
+	limits Limits
+	// values and calls count the values produced and the processors invoked.
+	values, calls int
+	// interruption is the reason why the execution is stopped,
+	// truncated reports whether it is stopped by an output dropped for MaxOutputBytes.
+	interruption string
+	truncated    bool
+	// errors stores the errors that do not belong to any node.
+	errors Errors
+	// fallback reports whether the default values also apply to the failed nodes,
+	// defaults are the paths of the nodes whose default values are used.
+	fallback bool
+	defaults []string
+	// strict reports whether the data is dropped when a required node is missing,
+	// missing reports whether any required node is missing.
+	strict, missing bool
+	// patterns are the regular expressions of the filters compiled in the execution.
+	patterns map[string]*regexp.Regexp
+	// nodeErrors stores node errors in the order they first occurred,
+	// times counts the occurrences of each of them.
+	nodeErrors []string
+	times      map[string]int
+	// stream is the array node whose elements are emitted instead of being kept in the output.
+	stream *stream
+}
+
+const (
+	// ErrInterrupted means the parse is stopped by its context
+	ErrInterrupted = "parse interrupted: %s"
+)
+
+func newExecution(ctx context.Context, graph *Graph, options ...Option) *execution {
+	exec := &execution{
+		graph: graph,
+		times: map[string]int{},
+	}
+	// the derived context is cancelled when a limit stops the execution,
+	// so that the pipelines being processed stop too.
+	exec.ctx, exec.cancel = context.WithCancel(ctx)
+	for _, option := range options {
+		option(exec)
+	}
+	return exec
+}
+
+// registry returns the registry of the processors called in the pipelines of the graph.
+func (exec *execution) registry() *pipeline.Registry {
+	return exec.graph.registry()
+}
+
+// parse parse graph all nodes against the document and returns the output data.
+func (exec *execution) parse(document selector.Selection) GraphRawData {
+	root := exec.newRoot(document)
+
+	// parse the GraphNode in turn, temporarily stored in the storage
+	storage := GraphObject{}
+	for _, node := range exec.graph.Nodes {
+		value := root.child(node).parse()
+		if value == nil {
+			break
+		}
+		storage[node.Key()] = value
+	}
+
+	// judge output type
+	switch exec.graph.GraphType {
+	case TypeObjectGraph:
+		// typeObjectGraph outputs the data as it is
+		return OutputObject(storage, false)
+	case TypeAtomGraph:
+		// typeAtomGraph only extracts the node data of the first non-virtual key
+		return OutputObject(storage, true)
+	default:
+		exec.addError(fmt.Sprintf(ErrWrongTypeCall,
+			"parse", "graph", exec.graph.GraphType,
+		))
+	}
+	return nil
+}
+
+// newRoot creates the scope of the virtual root node,
+// the user nodes of graph are the children of it.
+func (exec *execution) newRoot(selection selector.Selection) *scope {
+	root := &GraphNode{Name: TypeRootNode}
+	if exec.graph.Root != nil {
+		// copy it, so that the compiled root node is left untouched
+		*root = *exec.graph.Root
+	}
+	root.Children = exec.graph.Nodes
+	// root() in the pipelines is evaluated against the document
+	exec.ctx = pipeline.WithRoot(exec.ctx, selection)
+	return &scope{
+		exec:      exec,
+		node:      root,
+		selection: exec.limit(selection),
+		resolved:  true,
+	}
+}
+
+// interrupted reports whether the execution is stopped,
+// or the context of execution is cancelled or expired.
+func (exec *execution) interrupted() bool {
+	if exec.interruption != "" {
+		return true
+	}
+	if err := exec.ctx.Err(); err != nil {
+		exec.stop(fmt.Sprintf(ErrInterrupted, err))
+		return true
+	}
+	return false
+}
+
+// stop stops the execution, only the first reason is recorded.
+func (exec *execution) stop(reason string) {
+	if exec.interruption != "" {
+		return
+	}
+	exec.interruption = reason
+	exec.addError(reason)
+	exec.cancel()
+}
+
+func (exec *execution) addError(errs ...interface{}) {
+	for _, err := range errs {
+		exec.errors = append(exec.errors, &Error{
+			Err: fmt.Sprint(err),
+		})
+	}
+}
+
+// addNodeError records an error of node, the same errors will be merged.
+func (exec *execution) addNodeError(node *GraphNode, err interface{}) {
+	msg := fmt.Sprintf("%s: %s", node.Name, err)
+	if _, exists := exec.times[msg]; !exists {
+		exec.nodeErrors = append(exec.nodeErrors, msg)
+	}
+	exec.times[msg]++
+}
+
+// Errors returns all the errors that occurred in the execution.
+func (exec *execution) Errors() (errs Errors) {
+	errs = append(errs, exec.errors...)
+	for _, msg := range exec.nodeErrors {
+		if times := exec.times[msg]; times > 1 {
+			msg = fmt.Sprintf("%s (%d times)", msg, times)
+		}
+		errs = append(errs, &Error{
+			Err: msg,
+		})
+	}
+	return
+}
+
+// record is the state of the results recorded by an execution, which can be restored by rollback.
+type record struct {
+	defaults, errors int
+	missing          bool
+}
+
+// mark returns the current state of the results recorded by the execution.
+func (exec *execution) mark() record {
+	return record{
+		defaults: len(exec.defaults),
+		errors:   len(exec.errors),
+		missing:  exec.missing,
+	}
+}
+
+// rollback drops the defaults and the validation errors recorded after the mark,
+// the other errors are kept like the ones restored by restoreRecords for a dropped element.
+func (exec *execution) rollback(mark record) {
+	exec.defaults = exec.defaults[:mark.defaults]
+	errors := exec.errors[:mark.errors]
+	for _, err := range exec.errors[mark.errors:] {
+		if _, ok := err.Detail.(*ValidationError); !ok {
+			errors = append(errors, err)
+		}
+	}
+	exec.errors = errors
+	exec.missing = mark.missing
+}
+
+// elementRecord is the defaults and the errors recorded by an element of an ordered array node,
+// whose paths start with the path of the element before it is arranged.
+type elementRecord struct {
+	path     string
+	defaults []string
+	errors   Errors
+}
+
+// takeRecords takes away the defaults and the errors recorded by the element at path after the mark.
+func (exec *execution) takeRecords(mark record, path string) *elementRecord {
+	conseq := &elementRecord{
+		path:     path,
+		defaults: append([]string(nil), exec.defaults[mark.defaults:]...),
+		errors:   append(Errors(nil), exec.errors[mark.errors:]...),
+	}
+	exec.defaults = exec.defaults[:mark.defaults]
+	exec.errors = exec.errors[:mark.errors]
+	exec.missing = mark.missing
+	return conseq
+}
+
+// restoreRecords records again the defaults and the errors taken away from an element,
+// the paths are moved to the path of its position in the output.
+// Only the errors other than the validation errors are restored when the element is dropped.
+func (exec *execution) restoreRecords(records *elementRecord, path string, kept bool) {
+	if kept {
+		for _, value := range records.defaults {
+			exec.defaults = append(exec.defaults, path+strings.TrimPrefix(value, records.path))
+		}
+	}
+	for _, err := range records.errors {
+		detail, ok := err.Detail.(*ValidationError)
+		switch {
+		case !ok:
+			exec.errors = append(exec.errors, err)
+		case kept:
+			detail = &ValidationError{
+				Path:   path + strings.TrimPrefix(detail.Path, records.path),
+				Reason: detail.Reason,
+			}
+			exec.missing = true
+			exec.errors = append(exec.errors, &Error{
+				Err:    detail.Error(),
+				Detail: detail,
+			})
+		}
+	}
+}
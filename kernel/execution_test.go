@@ -0,0 +1,49 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestExecution_Rollback(t *testing.T) {
+	validation := func(path string) *Error {
+		detail := &ValidationError{Path: path, Reason: ReasonEmpty}
+		return &Error{Err: detail.Error(), Detail: detail}
+	}
+	exec := newExecution(context.Background(), &Graph{})
+	exec.defaults = []string{"a"}
+	exec.errors = Errors{validation("a")}
+	exec.missing = true
+	mark := exec.mark()
+	exec.defaults = append(exec.defaults, "items[0].b")
+	exec.errors = append(exec.errors, validation("items[0].c"), &Error{Err: "stopped"})
+	exec.rollback(mark)
+	var got []string
+	for _, err := range exec.errors {
+		got = append(got, err.Err)
+	}
+	if want := []string{`required node "a" is empty`, "stopped"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("execution.rollback() errors = %q, want %q", got, want)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(exec.defaults, want) {
+		t.Errorf("execution.rollback() defaults = %q, want %q", exec.defaults, want)
+	}
+	if !exec.missing {
+		t.Errorf("execution.rollback() missing = %v, want %v", exec.missing, true)
+	}
+}
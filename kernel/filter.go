@@ -0,0 +1,270 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Predicate is the filter of an array node, such as `price > 0 && name =~ "^A"`,
+// the elements of the array which do not match it are left out of the output.
+type Predicate struct {
+	// Op is the operator of the predicate, such as "&&", "!" or ">",
+	// or the kind of an operand, such as OperandChild or OperandString.
+	Op string
+	// Operands are the operands of an operator.
+	Operands []*Predicate
+	// Value is the name of the child node or the literal of an operand.
+	Value string
+}
+
+const (
+	// OpAnd matches when all of the operands match
+	OpAnd = "&&"
+	// OpOr matches when any of the operands matches
+	OpOr = "||"
+	// OpNot matches when the operand does not match
+	OpNot = "!"
+	// OpMatch matches when the left operand matches the regular expression on the right
+	OpMatch = "=~"
+	// OpNotMatch matches when the left operand does not match the regular expression on the right
+	OpNotMatch = "!~"
+)
+
+const (
+	// OperandChild refers to the value of a leaf child of the element
+	OperandChild = "child"
+	// OperandString is a quoted string, such as "USD"
+	OperandString = "string"
+	// OperandNumber is a number, such as -1.5
+	OperandNumber = "number"
+	// OperandBool is true or false
+	OperandBool = "bool"
+	// OperandNull is null
+	OperandNull = "null"
+)
+
+// Comparisons are the operators which compare two operands, ordered by the length of them,
+// so that the longer ones are tried first when they are read.
+var Comparisons = []string{"==", "!=", "<=", ">=", OpMatch, OpNotMatch, "<", ">"}
+
+// IsComparison reports whether op is one of the Comparisons.
+func IsComparison(op string) bool {
+	for _, comparison := range Comparisons {
+		if comparison == op {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOperand reports whether op is the kind of an operand.
+func IsOperand(op string) bool {
+	switch op {
+	case OperandChild, OperandString, OperandNumber, OperandBool, OperandNull:
+		return true
+	}
+	return false
+}
+
+// operand is the value of an operand when a predicate is evaluated.
+type operand struct {
+	null    bool
+	text    string
+	number  float64
+	numeric bool
+}
+
+// truthy reports whether the operand is taken as true when it is used alone,
+// null, "", "false" and 0 are false.
+func (value operand) truthy() bool {
+	if value.numeric {
+		return value.number != 0
+	}
+	return !value.null && value.text != "" && value.text != "false"
+}
+
+// match reports whether the element whose children have the values matches the predicate.
+func (s *scope) match(predicate *Predicate, values map[string]*GraphData) bool {
+	switch predicate.Op {
+	case OpAnd:
+		for _, child := range predicate.Operands {
+			if !s.match(child, values) {
+				return false
+			}
+		}
+		return true
+	case OpOr:
+		for _, child := range predicate.Operands {
+			if s.match(child, values) {
+				return true
+			}
+		}
+		return false
+	case OpNot:
+		return !s.match(predicate.Operands[0], values)
+	}
+	if IsOperand(predicate.Op) {
+		return s.operand(predicate, values).truthy()
+	}
+	left, right := s.operand(predicate.Operands[0], values), s.operand(predicate.Operands[1], values)
+	return s.compare(predicate.Op, left, right)
+}
+
+// operand returns the value of an operand, a child without value is null.
+func (s *scope) operand(predicate *Predicate, values map[string]*GraphData) operand {
+	switch predicate.Op {
+	case OperandNull:
+		return operand{null: true}
+	case OperandNumber:
+		number, err := strconv.ParseFloat(predicate.Value, 64)
+		return operand{text: predicate.Value, number: number, numeric: err == nil}
+	case OperandChild:
+	default:
+		return operand{text: predicate.Value}
+	}
+	return operandOf(values[predicate.Value])
+}
+
+// operandOf returns the value of a leaf as an operand, the containers are null.
+func operandOf(data *GraphData) operand {
+	if data == nil || data.Dnull {
+		return operand{null: true}
+	}
+	switch data.Dtype {
+	case TypeString:
+		return operand{text: data.Dstring}
+	case TypeFloat64:
+		return operand{text: strconv.FormatFloat(data.Dfloat64, 'f', -1, 64), number: data.Dfloat64, numeric: true}
+	case TypeInt64:
+		return operand{text: strconv.FormatInt(data.Dint64, 10), number: float64(data.Dint64), numeric: true}
+	case TypeBool:
+		return operand{text: strconv.FormatBool(data.Dbool)}
+	}
+	// the containers have no value to compare
+	return operand{null: true}
+}
+
+// compare compares the operands with the comparison operator op.
+// Two operands are compared as numbers when one of them is a number and the other can be converted,
+// otherwise they are compared as strings. null only equals null.
+func (s *scope) compare(op string, left operand, right operand) bool {
+	switch op {
+	case OpMatch, OpNotMatch:
+		expr, err := s.exec.pattern(right.text)
+		if err != nil {
+			s.addError(err)
+			return false
+		}
+		matched := !left.null && expr.MatchString(left.text)
+		return matched == (op == OpMatch)
+	}
+	if left.null || right.null {
+		switch op {
+		case "==":
+			return left.null == right.null
+		case "!=":
+			return left.null != right.null
+		}
+		return false
+	}
+	var conseq int
+	if l, r, ok := numbers(left, right); ok {
+		switch {
+		case l < r:
+			conseq = -1
+		case l > r:
+			conseq = 1
+		}
+	} else {
+		conseq = strings.Compare(left.text, right.text)
+	}
+	switch op {
+	case "==":
+		return conseq == 0
+	case "!=":
+		return conseq != 0
+	case "<":
+		return conseq < 0
+	case "<=":
+		return conseq <= 0
+	case ">":
+		return conseq > 0
+	case ">=":
+		return conseq >= 0
+	}
+	return false
+}
+
+// numbers returns the operands as numbers when one of them is a number
+// and the other one is a number or can be converted to a number.
+func numbers(left operand, right operand) (float64, float64, bool) {
+	if !left.numeric && !right.numeric {
+		return 0, 0, false
+	}
+	for _, value := range []*operand{&left, &right} {
+		if value.numeric {
+			continue
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(value.text), 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		value.number = number
+	}
+	return left.number, right.number, true
+}
+
+// compilePatterns compiles the regular expressions of the matches in the predicate into patterns.
+func compilePatterns(predicate *Predicate, patterns map[string]*regexp.Regexp) error {
+	if (predicate.Op == OpMatch || predicate.Op == OpNotMatch) && predicate.Operands[1].Op == OperandString {
+		expr := predicate.Operands[1].Value
+		if _, exists := patterns[expr]; !exists {
+			conseq, err := regexp.Compile(expr)
+			if err != nil {
+				return err
+			}
+			patterns[expr] = conseq
+		}
+	}
+	for _, operand := range predicate.Operands {
+		if err := compilePatterns(operand, patterns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pattern returns the compiled regular expression,
+// the ones of a bound graph are compiled by Bind, the others are compiled once in an execution.
+func (exec *execution) pattern(expr string) (*regexp.Regexp, error) {
+	if conseq, exists := exec.graph.patterns[expr]; exists {
+		return conseq, nil
+	}
+	if conseq, exists := exec.patterns[expr]; exists {
+		return conseq, nil
+	}
+	conseq, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if exec.patterns == nil {
+		exec.patterns = map[string]*regexp.Regexp{}
+	}
+	exec.patterns[expr] = conseq
+	return conseq, nil
+}
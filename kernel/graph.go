@@ -16,13 +16,19 @@
 package kernel
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 	"strings"
 
+	"github.com/storyicon/graphquery/kernel/pipeline"
 	"github.com/storyicon/graphquery/kernel/selector"
 )
 
-// Graph is a parsed Graph tree
+// Graph is a parsed Graph tree.
+// A compiled Graph is never written to while parsing,
+// all the state of a parse lives in the execution of that call,
+// so one Graph can be parsed from any number of goroutines.
 type Graph struct {
 	// Root is the virtual root node
 	Root *GraphNode
@@ -30,9 +36,34 @@ type Graph struct {
 	Nodes []*GraphNode
 	// GraphType identifies the output form of Graph.
 	GraphType int
-	// Data stores analytic data.
-	Data   GraphRawData
-	Errors Errors
+	// Fragments are the fragment definitions of the expression,
+	// the nodes spread from them are already expanded in Nodes.
+	Fragments []*GraphNode
+	// Imports are the files imported by the expression,
+	// the fragments taken from them are already expanded too.
+	Imports []*Import
+	// Registry provides the processors called in the pipelines,
+	// the graph is parsed with pipeline.Default when it is nil.
+	Registry *pipeline.Registry
+	// templates are the segments of the arguments with variables cached by Bind,
+	// patterns are the regular expressions of the filters compiled by Bind.
+	templates map[string][]segment
+	patterns  map[string]*regexp.Regexp
+}
+
+// registry returns the registry of the processors called in the pipelines of the graph.
+func (graph *Graph) registry() *pipeline.Registry {
+	if graph.Registry != nil {
+		return graph.Registry
+	}
+	return pipeline.Default
+}
+
+// Import is an expression file imported by the expression.
+type Import struct {
+	Path string
+	// Alias is the name of the fragment made of the nodes of the imported file.
+	Alias string
 }
 
 const (
@@ -49,77 +80,34 @@ const (
 
 // Parse builds the relationship between user nodes and ROOT nodes,
 // parse all node data and returns.
-func (graph *Graph) Parse(document string) *GraphResponse {
-	defer func() {
-		if err := recover(); err != nil {
-			graph.addError(fmt.Sprintf("Fatal Error: %s", err))
-		}
-	}()
-	graph.Root.Selection, _ = selector.NewString(document)
-	graph.Root.derivate(graph.Nodes)
-	graph.parse()
-	graph.bubbleErrors()
-
-	return &GraphResponse{
-		Data:   graph.Data,
-		Errors: graph.Errors,
-	}
+func (graph *Graph) Parse(document string, options ...Option) *GraphResponse {
+	return graph.ParseContext(context.Background(), document, options...)
 }
 
-// parse parse graph all nodes and write to graph.data.
-func (graph *Graph) parse() {
-	// parse the GraphNode in turn, temporarily stored in the storage
-	storage := GraphObject{}
-	for _, node := range graph.Nodes {
-		storage[node.Name] = node.Parse()
-	}
-
-	// judge output type
-	switch graph.GraphType {
-	case TypeObjectGraph:
-		// typeObjectGraph outputs the data as it is
-		graph.Data = OutputObject(storage, false)
-	case TypeAtomGraph:
-		// typeAtomGraph only extracts the node data of the first non-virtual key
-		graph.Data = OutputObject(storage, true)
-	default:
-		graph.addError(fmt.Sprintf(ErrWrongTypeCall,
-			"parse", "graph", graph.GraphType,
-		))
-	}
-
+// ParseContext is like Parse, but stops parsing when ctx is cancelled or expired,
+// the data parsed so far is returned and the reason is recorded in the Errors of response.
+func (graph *Graph) ParseContext(ctx context.Context, document string, options ...Option) (response *GraphResponse) {
+	selection, _ := selector.NewString(document)
+	return graph.parseSelection(ctx, selection, options...)
 }
 
-// BubbleErrors collects node errors from the root node of the tree, traversing the entire tree.
-func (graph *Graph) bubbleErrors() {
-	storage := map[string]int{}
-	graph.Root.traverse(func(node *GraphNode) bool {
-		if len(node.errors) > 0 {
-			for _, err := range node.errors {
-				err := fmt.Sprintf("%s: %s", node.Name, err)
-				if _, exists := storage[err]; exists {
-					storage[err]++
-					continue
-				}
-				storage[err] = 1
-			}
-		}
-		return true
-	})
-	for err, times := range storage {
-		if times > 1 {
-			err = fmt.Sprintf("%s (%d times)", err, times)
+// parseSelection parses all the nodes against the selection of the document.
+func (graph *Graph) parseSelection(ctx context.Context, document selector.Selection, options ...Option) (response *GraphResponse) {
+	exec := newExecution(ctx, graph, options...)
+	response = &GraphResponse{}
+	defer func() {
+		if err := recover(); err != nil {
+			exec.addError(fmt.Sprintf("Fatal Error: %s", err))
 		}
-		graph.addError(err)
-	}
-}
-
-func (graph *Graph) addError(errs ...interface{}) {
-	for _, err := range errs {
-		graph.Errors = append(graph.Errors, &Error{
-			Err: fmt.Sprint(err),
-		})
+		exec.cancel()
+		response.Errors = exec.Errors()
+		response.Defaults = exec.defaults
+	}()
+	response.Data = exec.parse(document)
+	if exec.strict && exec.missing {
+		response.Data = nil
 	}
+	return
 }
 
 // IsVisualKey determines whether a key is a virtual key based on the key name
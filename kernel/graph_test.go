@@ -1,9 +1,14 @@
 package kernel
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/storyicon/graphquery/kernel/pipeline"
+	"github.com/storyicon/graphquery/kernel/selector"
 )
 
 func TestGraph_Parse(t *testing.T) {
@@ -467,3 +472,187 @@ func TestGraph_Parse(t *testing.T) {
 	}
 
 }
+
+func TestGraph_ParseConcurrently(t *testing.T) {
+	graph := &Graph{
+		Root: &GraphNode{
+			Name: "__ROOT__",
+		},
+		Nodes: []*GraphNode{
+			{
+				Name: "title",
+				Pipelines: []*pipeline.Pipeline{
+					{
+						Name: "css",
+						Args: []string{".title"},
+					},
+				},
+			},
+			{
+				Name:     "items",
+				NodeType: TypeObjectArray,
+				Pipelines: []*pipeline.Pipeline{
+					{
+						Name: "css",
+						Args: []string{".item"},
+					},
+				},
+				Children: []*GraphNode{
+					{
+						Name: "name",
+						Pipelines: []*pipeline.Pipeline{
+							{
+								Name: "text",
+							},
+						},
+					},
+					{
+						Name: "label",
+						Pipelines: []*pipeline.Pipeline{
+							{
+								Name: "template",
+								Args: []string{"{$title}-{$name}"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	document := func(i int) string {
+		return fmt.Sprintf(`<div class="title">page%d</div><div class="item">a%d</div><div class="item">b%d</div>`, i, i, i)
+	}
+	want := func(i int) string {
+		return fmt.Sprintf(`{"data":{"items":[{"label":"page%d-a%d","name":"a%d"},{"label":"page%d-b%d","name":"b%d"}],"title":"page%d"},"errors":null}`,
+			i, i, i, i, i, i, i,
+		)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 8; j++ {
+				if got := graph.Parse(document(i)).String(); got != want(i) {
+					t.Errorf("Graph.Parse() = %v, want %v", got, want(i))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestGraph_ParseContext(t *testing.T) {
+	graph := &Graph{
+		Root: &GraphNode{
+			Name: "__ROOT__",
+		},
+		GraphType: TypeAtomGraph,
+		Nodes: []*GraphNode{
+			{
+				Name:     "items",
+				NodeType: TypeArray,
+				Pipelines: []*pipeline.Pipeline{
+					{
+						Name: "css",
+						Args: []string{".item"},
+					},
+				},
+				Children: []*GraphNode{
+					{
+						Name: "item",
+						Pipelines: []*pipeline.Pipeline{
+							{
+								Name: "text",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	document := `<div class="item">a</div><div class="item">b</div>`
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{
+			name: "test0",
+			ctx:  context.Background(),
+			want: `{"data":["a","b"],"errors":null}`,
+		},
+		{
+			name: "test1",
+			ctx:  cancelled,
+			want: `{"data":{},"errors":["parse interrupted: context canceled"]}`,
+		},
+		{
+			name: "test2",
+			ctx:  expired,
+			want: `{"data":{},"errors":["parse interrupted: context deadline exceeded"]}`,
+		},
+	}
+	for _, tt := range tests {
+		if got := graph.ParseContext(tt.ctx, document).String(); got != tt.want {
+			t.Errorf("%q. Graph.ParseContext() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGraph_ParseContext_Partial(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the processor is registered with a private registry, so that the test can be run repeatedly
+	registry := pipeline.Default.Clone()
+	if err := registry.Regist("testcancel", func(node selector.Selection, args []string) (selector.Selection, error) {
+		if node.Text() == args[0] {
+			cancel()
+		}
+		return node, nil
+	}, 1); err != nil {
+		t.Fatal(err)
+	}
+	graph := &Graph{
+		Registry: registry,
+		Root: &GraphNode{
+			Name: "__ROOT__",
+		},
+		GraphType: TypeAtomGraph,
+		Nodes: []*GraphNode{
+			{
+				Name:     "items",
+				NodeType: TypeArray,
+				Pipelines: []*pipeline.Pipeline{
+					{
+						Name: "css",
+						Args: []string{".item"},
+					},
+				},
+				Children: []*GraphNode{
+					{
+						Name: "item",
+						Pipelines: []*pipeline.Pipeline{
+							{
+								Name: "testcancel",
+								Args: []string{"b"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	// the value of "b" is completed before the cancellation is noticed, the elements after it are not parsed
+	want := `{"data":["a","b"],"errors":["parse interrupted: context canceled"]}`
+	if got := graph.ParseContext(ctx, `<p class="item">a</p><p class="item">b</p><p class="item">c</p>`).String(); got != want {
+		t.Errorf("Graph.ParseContext() = %v, want %v", got, want)
+	}
+}
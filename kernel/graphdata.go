@@ -27,6 +27,9 @@ type GraphData struct {
 
 	Dstring      string
 	Dfloat64     float64
+	Dint64       int64
+	Dbool        bool
+	Dnull        bool
 	Dobject      GraphObject
 	DobjectArray []GraphObject
 	Darray       []*GraphData
@@ -43,6 +46,8 @@ const (
 	ErrWrongTypeCall = "call the %s method on %s of wrong type %d"
 	// ErrPushOverflow means data push overflow
 	ErrPushOverflow = "graph data push overflow"
+	// ErrWrongValue means the value can not be converted to the type of GraphData
+	ErrWrongValue = "can not convert %q to %s"
 )
 
 // NewGraphData is used to initialize a GraphData.
@@ -54,18 +59,36 @@ func NewGraphData(name string, dataType int) *GraphData {
 }
 
 // Value used to set atomized values for GraphData
+// the values of types other than TypeString are trimmed before conversion,
+// they are null when they are empty or can not be converted.
 func (data *GraphData) Value(val string) (err error) {
 	switch data.Dtype {
 	case TypeString:
 		data.Dstring = val
-	case TypeFloat64:
-		data.Dfloat64, err = strconv.ParseFloat(val, 64)
+		return nil
+	case TypeFloat64, TypeInt64, TypeBool:
 	default:
 		return fmt.Errorf(ErrWrongTypeCall,
 			"value", "graph data", data.Dtype,
 		)
 	}
-	return
+	if val = strings.TrimSpace(val); val == "" {
+		data.Dnull = true
+		return nil
+	}
+	switch data.Dtype {
+	case TypeFloat64:
+		data.Dfloat64, err = strconv.ParseFloat(val, 64)
+	case TypeInt64:
+		data.Dint64, err = strconv.ParseInt(val, 10, 64)
+	case TypeBool:
+		data.Dbool, err = strconv.ParseBool(val)
+	}
+	if err != nil {
+		data.Dnull = true
+		return fmt.Errorf(ErrWrongValue, val, LeafTypeName(data.Dtype))
+	}
+	return nil
 }
 
 // Set is used to set new value to Object type GraphData.
@@ -110,11 +133,18 @@ func (data *GraphData) Push(index int, key string, val *GraphData) (err error) {
 
 // Output is used to output the corresponding type of data from GraphData
 func (data *GraphData) Output() GraphRawData {
+	if data.Dnull {
+		return nil
+	}
 	switch data.Dtype {
 	case TypeString:
 		return data.Dstring
 	case TypeFloat64:
 		return data.Dfloat64
+	case TypeInt64:
+		return data.Dint64
+	case TypeBool:
+		return data.Dbool
 	case TypeArray:
 		var conseq []GraphRawData
 		for _, unit := range data.Darray {
@@ -0,0 +1,458 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+
+	"github.com/storyicon/graphquery/kernel/pipeline"
+)
+
+// GraphVersion is the version of the JSON AST written by Graph.MarshalJSON,
+// version 2 adds the sub-pipelines of the pipelines. LoadGraph loads all the versions up to it.
+const GraphVersion = 2
+
+const (
+	// ErrGraphVersion means the JSON AST is written in an unsupported version
+	ErrGraphVersion = "unsupported graph version %d, expect 1 to %d"
+	// ErrGraphField means a field of the JSON AST has an undefined value
+	ErrGraphField = "undefined %s %q in %s"
+	// ErrGraphOperands means a predicate of the JSON AST has a wrong number of operands
+	ErrGraphOperands = "wrong number %d of operands of %q in %s"
+	// ErrGraphExprs means a pipeline of the JSON AST has a wrong number of sub-pipelines
+	ErrGraphExprs = "wrong number %d of expressions of %q, expect %d in %s"
+)
+
+// graphJSON is the JSON AST of Graph.
+type graphJSON struct {
+	Version   int            `json:"version"`
+	Type      string         `json:"type"`
+	Comments  []*commentJSON `json:"comments,omitempty"`
+	Imports   []*importJSON  `json:"imports,omitempty"`
+	Fragments []*nodeJSON    `json:"fragments,omitempty"`
+	Nodes     []*nodeJSON    `json:"nodes"`
+}
+
+// nodeJSON is the JSON AST of GraphNode.
+type nodeJSON struct {
+	Name       string          `json:"name"`
+	Alias      string          `json:"alias,omitempty"`
+	Fragment   string          `json:"fragment,omitempty"`
+	Definition string          `json:"definition,omitempty"`
+	Type       string          `json:"type"`
+	Required   bool            `json:"required,omitempty"`
+	Pipelines  []*pipelineJSON `json:"pipelines"`
+	Default    *defaultJSON    `json:"default,omitempty"`
+	Filter     *predicateJSON  `json:"filter,omitempty"`
+	List       *listJSON       `json:"list,omitempty"`
+	Children   []*nodeJSON     `json:"children,omitempty"`
+	Comments   []*commentJSON  `json:"comments,omitempty"`
+}
+
+// importJSON is the JSON AST of Import.
+type importJSON struct {
+	Path  string `json:"path"`
+	Alias string `json:"alias,omitempty"`
+}
+
+// defaultJSON is the JSON AST of Default.
+type defaultJSON struct {
+	Value string `json:"value,omitempty"`
+	Null  bool   `json:"null,omitempty"`
+}
+
+// predicateJSON is the JSON AST of Predicate.
+type predicateJSON struct {
+	Op       string           `json:"op"`
+	Operands []*predicateJSON `json:"operands,omitempty"`
+	Value    string           `json:"value,omitempty"`
+}
+
+// listJSON is the JSON AST of ListOperators.
+type listJSON struct {
+	Unique     bool   `json:"unique,omitempty"`
+	UniqueBy   string `json:"uniqueBy,omitempty"`
+	Sort       bool   `json:"sort,omitempty"`
+	SortBy     string `json:"sortBy,omitempty"`
+	SortMode   string `json:"sortMode,omitempty"`
+	Descending bool   `json:"descending,omitempty"`
+	Reverse    bool   `json:"reverse,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+}
+
+// pipelineJSON is the JSON AST of Pipeline.
+type pipelineJSON struct {
+	Name  string            `json:"name"`
+	Args  []string          `json:"args"`
+	Exprs [][]*pipelineJSON `json:"exprs,omitempty"`
+}
+
+// commentJSON is the JSON AST of Comment.
+type commentJSON struct {
+	Text     string `json:"text"`
+	Position string `json:"position"`
+}
+
+// graphTypes, nodeTypes and commentPositions are the names used by the JSON AST.
+var (
+	graphTypes = map[int]string{
+		TypeObjectGraph: "object",
+		TypeAtomGraph:   "atom",
+	}
+	nodeTypes = map[int]string{
+		TypeString:      "string",
+		TypeFloat64:     "float",
+		TypeInt64:       "int",
+		TypeBool:        "bool",
+		TypeObject:      "object",
+		TypeArray:       "array",
+		TypeObjectArray: "objectArray",
+	}
+	commentPositions = map[int]string{
+		CommentLeading:  "leading",
+		CommentTrailing: "trailing",
+		CommentClosing:  "closing",
+	}
+)
+
+// MarshalJSON implements the json.Marshaller interface.
+// The graph is written as a versioned JSON AST which can be loaded back by LoadGraph.
+func (graph *Graph) MarshalJSON() ([]byte, error) {
+	conseq := &graphJSON{
+		Version: GraphVersion,
+		Type:    graphTypes[graph.GraphType],
+		Nodes:   []*nodeJSON{},
+	}
+	if conseq.Type == "" {
+		return nil, fmt.Errorf(ErrWrongTypeCall, "marshal", "graph", graph.GraphType)
+	}
+	if graph.Root != nil {
+		conseq.Comments = marshalComments(graph.Root.Comments)
+	}
+	for _, imported := range graph.Imports {
+		conseq.Imports = append(conseq.Imports, &importJSON{
+			Path:  imported.Path,
+			Alias: imported.Alias,
+		})
+	}
+	for _, node := range graph.Fragments {
+		value, err := marshalNode(node)
+		if err != nil {
+			return nil, err
+		}
+		conseq.Fragments = append(conseq.Fragments, value)
+	}
+	for _, node := range graph.Nodes {
+		value, err := marshalNode(node)
+		if err != nil {
+			return nil, err
+		}
+		conseq.Nodes = append(conseq.Nodes, value)
+	}
+	return json.Marshal(conseq)
+}
+
+// LoadGraph is used to load a Graph from the JSON AST written by Graph.MarshalJSON.
+// The graph is bound like a compiled one, so that its invalid selectors and regular expressions are rejected.
+func LoadGraph(data []byte) (*Graph, error) {
+	return LoadGraphRegistry(data, nil)
+}
+
+// LoadGraphRegistry is like LoadGraph, but the graph is bound to registry,
+// which provides the processors called in its pipelines, the default registry is used when it is nil.
+func LoadGraphRegistry(data []byte, registry *pipeline.Registry) (*Graph, error) {
+	var value graphJSON
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	if value.Version < 1 || value.Version > GraphVersion {
+		return nil, fmt.Errorf(ErrGraphVersion, value.Version, GraphVersion)
+	}
+	graphType, ok := lookUpName(graphTypes, value.Type)
+	if !ok {
+		return nil, fmt.Errorf(ErrGraphField, "graph type", value.Type, "graph")
+	}
+	comments, err := loadComments(value.Comments, TypeRootNode)
+	if err != nil {
+		return nil, err
+	}
+	graph := &Graph{
+		Root: &GraphNode{
+			Name:     TypeRootNode,
+			Comments: comments,
+		},
+		GraphType: graphType,
+		Registry:  registry,
+	}
+	for _, imported := range value.Imports {
+		graph.Imports = append(graph.Imports, &Import{
+			Path:  imported.Path,
+			Alias: imported.Alias,
+		})
+	}
+	for _, node := range value.Fragments {
+		conseq, err := loadNode(node)
+		if err != nil {
+			return nil, err
+		}
+		graph.Fragments = append(graph.Fragments, conseq)
+	}
+	for _, node := range value.Nodes {
+		conseq, err := loadNode(node)
+		if err != nil {
+			return nil, err
+		}
+		graph.Nodes = append(graph.Nodes, conseq)
+	}
+	if err := graph.Bind(); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+func marshalNode(node *GraphNode) (*nodeJSON, error) {
+	conseq := &nodeJSON{
+		Name:       node.Name,
+		Alias:      node.Alias,
+		Fragment:   node.Fragment,
+		Definition: node.Definition,
+		Type:       nodeTypes[node.NodeType],
+		Required:   node.Required,
+		Pipelines:  []*pipelineJSON{},
+		Comments:   marshalComments(node.Comments),
+	}
+	if conseq.Type == "" {
+		return nil, fmt.Errorf(ErrWrongTypeCall, "marshal", "graph node", node.NodeType)
+	}
+	if node.Default != nil {
+		conseq.Default = &defaultJSON{
+			Value: node.Default.Value,
+			Null:  node.Default.Null,
+		}
+	}
+	if node.Filter != nil {
+		conseq.Filter = marshalPredicate(node.Filter)
+	}
+	if list := node.List; list != nil {
+		conseq.List = &listJSON{
+			Unique:     list.Unique,
+			UniqueBy:   list.UniqueBy,
+			Sort:       list.Sort,
+			SortBy:     list.SortBy,
+			SortMode:   list.SortMode,
+			Descending: list.Descending,
+			Reverse:    list.Reverse,
+			Offset:     list.Offset,
+			Limit:      list.Limit,
+		}
+	}
+	conseq.Pipelines = marshalPipelines(node.Pipelines)
+	for _, child := range node.Children {
+		value, err := marshalNode(child)
+		if err != nil {
+			return nil, err
+		}
+		conseq.Children = append(conseq.Children, value)
+	}
+	return conseq, nil
+}
+
+func loadNode(value *nodeJSON) (*GraphNode, error) {
+	nodeType, ok := lookUpName(nodeTypes, value.Type)
+	if !ok {
+		return nil, fmt.Errorf(ErrGraphField, "node type", value.Type, value.Name)
+	}
+	comments, err := loadComments(value.Comments, value.Name)
+	if err != nil {
+		return nil, err
+	}
+	node := &GraphNode{
+		Name:       value.Name,
+		Alias:      value.Alias,
+		Fragment:   value.Fragment,
+		Definition: value.Definition,
+		NodeType:   nodeType,
+		Required:   value.Required,
+		Comments:   comments,
+	}
+	if value.Default != nil {
+		node.Default = &Default{
+			Value: value.Default.Value,
+			Null:  value.Default.Null,
+		}
+	}
+	if value.Filter != nil {
+		if node.Filter, err = loadPredicate(value.Filter, value.Name); err != nil {
+			return nil, err
+		}
+	}
+	if list := value.List; list != nil {
+		if list.SortMode != "" && !IsSortMode(list.SortMode) {
+			return nil, fmt.Errorf(ErrGraphField, "sort mode", list.SortMode, value.Name)
+		}
+		node.List = &ListOperators{
+			Unique:     list.Unique,
+			UniqueBy:   list.UniqueBy,
+			Sort:       list.Sort,
+			SortBy:     list.SortBy,
+			SortMode:   list.SortMode,
+			Descending: list.Descending,
+			Reverse:    list.Reverse,
+			Offset:     list.Offset,
+			Limit:      list.Limit,
+		}
+	}
+	if node.Pipelines, err = loadPipelines(value.Pipelines, value.Name); err != nil {
+		return nil, err
+	}
+	for _, child := range value.Children {
+		conseq, err := loadNode(child)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, conseq)
+	}
+	return node, nil
+}
+
+func marshalPipelines(pipelines pipeline.Pipelines) []*pipelineJSON {
+	conseq := []*pipelineJSON{}
+	for _, pipe := range pipelines {
+		args := pipe.Args
+		if args == nil {
+			args = []string{}
+		}
+		value := &pipelineJSON{
+			Name: pipe.Name,
+			Args: args,
+		}
+		for _, expr := range pipe.Exprs {
+			var exprJSON []*pipelineJSON
+			if expr != nil {
+				exprJSON = marshalPipelines(expr)
+			}
+			value.Exprs = append(value.Exprs, exprJSON)
+		}
+		conseq = append(conseq, value)
+	}
+	return conseq
+}
+
+func loadPipelines(values []*pipelineJSON, name string) (pipeline.Pipelines, error) {
+	var conseq pipeline.Pipelines
+	for _, pipe := range values {
+		var args []string
+		if len(pipe.Args) > 0 {
+			args = pipe.Args
+		}
+		if len(pipe.Exprs) > 0 && len(pipe.Exprs) != len(pipe.Args) {
+			return nil, fmt.Errorf(ErrGraphExprs, len(pipe.Exprs), pipe.Name, len(pipe.Args), name)
+		}
+		value := &pipeline.Pipeline{
+			Name: pipe.Name,
+			Args: args,
+		}
+		for _, expr := range pipe.Exprs {
+			var exprs pipeline.Pipelines
+			if expr != nil {
+				var err error
+				if exprs, err = loadPipelines(expr, name); err != nil {
+					return nil, err
+				}
+			}
+			value.Exprs = append(value.Exprs, exprs)
+		}
+		conseq = append(conseq, value)
+	}
+	return conseq, nil
+}
+
+func marshalPredicate(predicate *Predicate) *predicateJSON {
+	conseq := &predicateJSON{
+		Op:    predicate.Op,
+		Value: predicate.Value,
+	}
+	for _, operand := range predicate.Operands {
+		conseq.Operands = append(conseq.Operands, marshalPredicate(operand))
+	}
+	return conseq
+}
+
+// loadPredicate loads the predicate and checks the number of operands of its operator.
+func loadPredicate(value *predicateJSON, name string) (*Predicate, error) {
+	var expect bool
+	switch n := len(value.Operands); {
+	case value.Op == OpAnd || value.Op == OpOr:
+		expect = n > 0
+	case value.Op == OpNot:
+		expect = n == 1
+	case IsComparison(value.Op):
+		expect = n == 2
+	case IsOperand(value.Op):
+		expect = n == 0
+	default:
+		return nil, fmt.Errorf(ErrGraphField, "predicate operator", value.Op, name)
+	}
+	if !expect {
+		return nil, fmt.Errorf(ErrGraphOperands, len(value.Operands), value.Op, name)
+	}
+	predicate := &Predicate{
+		Op:    value.Op,
+		Value: value.Value,
+	}
+	for _, operand := range value.Operands {
+		conseq, err := loadPredicate(operand, name)
+		if err != nil {
+			return nil, err
+		}
+		predicate.Operands = append(predicate.Operands, conseq)
+	}
+	return predicate, nil
+}
+
+func marshalComments(comments []*Comment) (conseq []*commentJSON) {
+	for _, comment := range comments {
+		conseq = append(conseq, &commentJSON{
+			Text:     comment.Text,
+			Position: commentPositions[comment.Position],
+		})
+	}
+	return
+}
+
+func loadComments(values []*commentJSON, name string) (conseq []*Comment, err error) {
+	for _, value := range values {
+		position, ok := lookUpName(commentPositions, value.Position)
+		if !ok {
+			return nil, fmt.Errorf(ErrGraphField, "comment position", value.Position, name)
+		}
+		conseq = append(conseq, &Comment{
+			Text:     value.Text,
+			Position: position,
+		})
+	}
+	return
+}
+
+// lookUpName returns the key of name in names.
+func lookUpName(names map[int]string, name string) (int, bool) {
+	for key, value := range names {
+		if value == name {
+			return key, true
+		}
+	}
+	return 0, false
+}
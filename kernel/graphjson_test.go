@@ -0,0 +1,195 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/storyicon/graphquery/kernel/pipeline"
+	"github.com/storyicon/graphquery/kernel/selector"
+)
+
+func TestGraph_MarshalJSON(t *testing.T) {
+	graph := &Graph{
+		Root: &GraphNode{
+			Name: TypeRootNode,
+			Comments: []*Comment{
+				{Text: "// anchors", Position: CommentLeading},
+			},
+		},
+		Nodes: []*GraphNode{
+			{
+				Name:      "anchor",
+				Pipelines: pipeline.Pipelines{{Name: "css", Args: []string{"a"}}},
+				NodeType:  TypeObjectArray,
+				Children: []*GraphNode{
+					{
+						Name:  "price",
+						Alias: "价格",
+						Pipelines: pipeline.Pipelines{
+							{Name: "text"},
+							{Name: "replace", Args: []string{",", ""}, Exprs: []pipeline.Pipelines{nil, {{Name: "link", Args: []string{"sep"}}}}},
+						},
+						NodeType: TypeFloat64,
+						Comments: []*Comment{
+							{Text: "/* price */", Position: CommentTrailing},
+						},
+					},
+				},
+			},
+		},
+		GraphType: TypeAtomGraph,
+	}
+	want := `{"version":2,"type":"atom","comments":[{"text":"// anchors","position":"leading"}],"nodes":[{"name":"anchor","type":"objectArray","pipelines":[{"name":"css","args":["a"]}],"children":[{"name":"price","alias":"价格","type":"float","pipelines":[{"name":"text","args":[]},{"name":"replace","args":[",",""],"exprs":[null,[{"name":"link","args":["sep"]}]]}],"comments":[{"text":"/* price */","position":"trailing"}]}]}]}`
+	data, err := graph.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Graph.MarshalJSON() error = %v", err)
+	}
+	if string(data) != want {
+		t.Errorf("Graph.MarshalJSON() = %s, want %s", data, want)
+	}
+	got, err := LoadGraph(data)
+	if err != nil {
+		t.Fatalf("LoadGraph() error = %v", err)
+	}
+	// the loaded graph is bound
+	if err := graph.Bind(); err != nil {
+		t.Fatalf("Graph.Bind() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, graph) {
+		t.Errorf("LoadGraph() = %s, want %s", got, graph)
+	}
+}
+
+func TestLoadGraph_Version1(t *testing.T) {
+	data := `{"version":1,"type":"object","nodes":[{"name":"anchor","type":"array","pipelines":[{"name":"css","args":["a"]}],"children":[{"name":"title","type":"string","pipelines":[{"name":"text","args":[]},{"name":"replace","args":[",",""]}]}]}]}`
+	want := &Graph{
+		Root: &GraphNode{
+			Name: TypeRootNode,
+		},
+		Nodes: []*GraphNode{
+			{
+				Name:      "anchor",
+				Pipelines: pipeline.Pipelines{{Name: "css", Args: []string{"a"}}},
+				NodeType:  TypeArray,
+				Children: []*GraphNode{
+					{
+						Name: "title",
+						Pipelines: pipeline.Pipelines{
+							{Name: "text"},
+							{Name: "replace", Args: []string{",", ""}},
+						},
+						NodeType: TypeString,
+					},
+				},
+			},
+		},
+		GraphType: TypeObjectGraph,
+	}
+	got, err := LoadGraph([]byte(data))
+	if err != nil {
+		t.Fatalf("LoadGraph() error = %v", err)
+	}
+	if err := want.Bind(); err != nil {
+		t.Fatalf("Graph.Bind() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadGraph() = %s, want %s", got, want)
+	}
+}
+
+func TestLoadGraph(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "test0",
+			data:    `{"version":3,"type":"object","nodes":[]}`,
+			wantErr: "unsupported graph version 3, expect 1 to 2",
+		},
+		{
+			name:    "test1",
+			data:    `{"version":2,"type":"list","nodes":[]}`,
+			wantErr: `undefined graph type "list" in graph`,
+		},
+		{
+			name:    "test2",
+			data:    `{"version":2,"type":"object","nodes":[{"name":"a","type":"object","pipelines":[],"children":[{"name":"b","type":"number","pipelines":[]}]}]}`,
+			wantErr: `undefined node type "number" in b`,
+		},
+		{
+			name:    "test3",
+			data:    `{"version":2,"type":"object","nodes":[{"name":"a","type":"string","pipelines":[],"comments":[{"text":"// a","position":"above"}]}]}`,
+			wantErr: `undefined comment position "above" in a`,
+		},
+		{
+			name:    "test4",
+			data:    `{"version":2,"type":"object","nodes":[{"name":"a","type":"array","pipelines":[],"filter":{"op":"<>","operands":[{"op":"child","value":"b"},{"op":"number","value":"1"}]}}]}`,
+			wantErr: `undefined predicate operator "<>" in a`,
+		},
+		{
+			name:    "test5",
+			data:    `{"version":2,"type":"object","nodes":[{"name":"a","type":"array","pipelines":[],"filter":{"op":"!","operands":[]}}]}`,
+			wantErr: `wrong number 0 of operands of "!" in a`,
+		},
+		{
+			name:    "test6",
+			data:    `{"version":2,"type":"object","nodes":[{"name":"a","type":"string","pipelines":[{"name":"replace","args":["a",""],"exprs":[null]}]}]}`,
+			wantErr: `wrong number 1 of expressions of "replace", expect 2 in a`,
+		},
+		{
+			name:    "test7",
+			data:    `{"version":2,"type":"object","nodes":[{"name":"a","type":"array","pipelines":[],"filter":{"op":"=~","operands":[{"op":"child","value":"b"},{"op":"string","value":"(a"}]}}]}`,
+			wantErr: "a: error parsing regexp: missing closing ): `(a`",
+		},
+		{
+			name:    "test8",
+			data:    `{"version":2,"type":"object","nodes":[{"name":"a","type":"string","pipelines":[{"name":"css","args":["a["]}]}]}`,
+			wantErr: `a: parameter expr of method css expects CSS selector, expected identifier, found EOF instead`,
+		},
+		{
+			name:    "test9",
+			data:    `{"version":2,"type":"object","nodes":[{"name":"a","type":"string","pipelines":[{"name":"missing","args":[]}]}]}`,
+			wantErr: `a: undefined method: missing`,
+		},
+	}
+	for _, tt := range tests {
+		if _, err := LoadGraph([]byte(tt.data)); err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%q. LoadGraph() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadGraphRegistry(t *testing.T) {
+	registry := pipeline.NewRegistry()
+	registry.Regist("upper", func(node selector.Selection, args []string) (selector.Selection, error) {
+		return selector.NewString(strings.ToUpper(node.Text()))
+	}, 0)
+	data := []byte(`{"version":2,"type":"object","nodes":[{"name":"a","type":"string","pipelines":[{"name":"upper","args":[]}]}]}`)
+	if _, err := LoadGraph(data); err == nil {
+		t.Errorf("LoadGraph() error = %v, want an undefined method", err)
+	}
+	graph, err := LoadGraphRegistry(data, registry)
+	if err != nil {
+		t.Fatalf("LoadGraphRegistry() error = %v", err)
+	}
+	if graph.Registry != registry {
+		t.Errorf("LoadGraphRegistry() Registry = %p, want %p", graph.Registry, registry)
+	}
+}
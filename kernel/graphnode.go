@@ -15,27 +15,66 @@
 package kernel
 
 import (
-	"fmt"
-	"regexp"
-	"strings"
-
 	"github.com/storyicon/graphquery/kernel/pipeline"
-	"github.com/storyicon/graphquery/kernel/selector"
 )
 
 // GraphNode is the atomic node in Graph.
+// GraphNode only describes the compiled expression,
+// the state of a parse is kept in the scope of the node.
 type GraphNode struct {
-	Name       string
+	Name string
+	// Alias is the key of the node in the output, Name is used when it is empty.
+	Alias string
+	// Fragment is the name of the fragment the node is spread from.
+	Fragment string
+	// Default is the value used when the node is empty, it is nil when there is no default value.
+	Default *Default
+	// Required reports whether the node must not be empty or failed, it is marked by "!".
+	Required bool
+	// Filter is the predicate of an array node, the elements which do not match it are left out.
+	Filter *Predicate
+	// List is the list operators of an array node, such as sort and limit.
+	List       *ListOperators
 	Definition string
 	Pipelines  pipeline.Pipelines
 	Children   []*GraphNode
 	NodeType   int
+	Comments   []*Comment
+}
+
+// Key returns the key of the node in the output.
+func (node *GraphNode) Key() string {
+	if node.Alias != "" {
+		return node.Alias
+	}
+	return node.Name
+}
 
-	Selection selector.Selection
-	Parent    *GraphNode
-	errors    []string
+// Default is the default value of a node.
+type Default struct {
+	// Value is converted to the type of the node like the values parsed from documents.
+	Value string
+	// Null reports whether the default value is null, which is the only default value of containers.
+	Null bool
+}
+
+// Comment is a comment of the expression kept on the GraphNode it belongs to.
+type Comment struct {
+	// Text is the comment with its delimiters, such as "// note" or "/* note */".
+	Text string
+	// Position describes where the comment is placed around the node.
+	Position int
 }
 
+const (
+	// CommentLeading is placed before the node.
+	CommentLeading = iota
+	// CommentTrailing follows the node on the same line.
+	CommentTrailing
+	// CommentClosing is placed before the closing bracket of the children of the node.
+	CommentClosing
+)
+
 const (
 	//TypeString describes the string type.
 	TypeString = iota
@@ -47,70 +86,48 @@ const (
 	TypeObjectArray
 	//TypeArray describes the []string, []float64, [][...] type.
 	TypeArray
+	//TypeInt64 describes the int64 type.
+	TypeInt64
+	//TypeBool describes the bool type.
+	TypeBool
 )
 
-const (
-	// ErrWrongArgNumber means wrong number of parameters
-	ErrWrongArgNumber = "method %s expects %d parameters, but %d received"
-	// ErrFatalError means fatal error occurred
-	ErrFatalError = "fatal error occurred while %s"
-)
-
-// Parse recursively resolves all nodes
-func (node *GraphNode) Parse() *GraphData {
-	conseq := NewGraphData(node.Name, node.NodeType)
-	selection := node.getSelection()
+// leafTypes maps the type annotations of leaf nodes to their types.
+var leafTypes = map[string]int{
+	"string": TypeString,
+	"float":  TypeFloat64,
+	"int":    TypeInt64,
+	"bool":   TypeBool,
+}
 
-	if selection != nil {
-		switch node.NodeType {
-		case TypeString, TypeFloat64:
-			if err := conseq.Value(node.String()); err != nil {
-				node.addError(err)
-			}
-		case TypeArray, TypeObjectArray:
-			selection.Each(func(i int, element selector.Selection) bool {
-				// Clearing cache when the node context changes
-				defer (func(node *GraphNode) {
-					node.each(func(j int, child *GraphNode) bool {
-						child.Selection = nil
-						return true
-					})
-				})(node)
+// LeafType returns the type of a leaf node annotation such as "float",
+// ok is false when the annotation is undefined.
+func LeafType(annotation string) (dataType int, ok bool) {
+	dataType, ok = leafTypes[annotation]
+	return
+}
 
-				node.Selection = element
-				node.each(func(j int, child *GraphNode) bool {
-					child.Parent = node
-					if err := conseq.Push(i, child.Name, child.Parse()); err != nil {
-						node.addError(err)
-						return false
-					}
-					return true
-				})
-				return true
-			})
-		case TypeObject:
-			node.each(func(j int, child *GraphNode) bool {
-				// Clearing cache when the node context changes
-				defer (func(node *GraphNode) {
-					child.Selection = nil
-				})(node)
-				child.Parent = node
-				if err := conseq.Set(child.Name, child.Parse()); err != nil {
-					node.addError(err)
-					return false
-				}
-				return true
-			})
-		default:
-			node.addError(fmt.Sprintf(ErrWrongTypeCall,
-				"parse", "graph node", node.NodeType,
-			))
+// LeafTypeName returns the annotation of a leaf node type,
+// it returns an empty string when dataType is not a leaf type.
+func LeafTypeName(dataType int) string {
+	for annotation, leafType := range leafTypes {
+		if leafType == dataType {
+			return annotation
 		}
 	}
+	return ""
+}
 
-	return conseq
+// IsLeafType reports whether dataType is the type of a leaf node.
+func IsLeafType(dataType int) bool {
+	return LeafTypeName(dataType) != ""
 }
 
+const (
+	// ErrFatalError means fatal error occurred
+	ErrFatalError = "fatal error occurred while %s"
+)
+
 // Traverse traverses the subtree from the current node
 // traversal contains the current node
 func (node *GraphNode) traverse(callback func(node *GraphNode) bool) {
@@ -124,175 +141,6 @@ func (node *GraphNode) traverse(callback func(node *GraphNode) bool) {
 	}
 }
 
-//derivate function build relationships for parent and child elements
-func (node *GraphNode) derivate(children []*GraphNode) {
-	node.Children = children
-	for _, child := range children {
-		child.Parent = node
-	}
-}
-
-func (node *GraphNode) addError(err interface{}) {
-	node.errors = append(node.errors, fmt.Sprint(err))
-}
-
-// getSelection is used to get the selection of the current node
-// from cache or to calculate selection by pipeline.
-func (node *GraphNode) getSelection() selector.Selection {
-	parent := node.Parent
-	//* parent == nil occurs only when node is a root node or a fatal error occurs.
-	//if it is a root node, because the selection of the root node is constant, it returns directly.
-	if parent == nil {
-		if node.Name != TypeRootNode {
-			node.addError(fmt.Sprintf(ErrFatalError,
-				"get selection",
-			))
-		}
-		return node.Selection
-	}
-	//When the node selection already exists, it returns directly.
-	//* Note that this will skip the node's calculation, so be sure to clear the node's selection value when the node's context changes
-	if node.Selection != nil {
-		return node.Selection
-	}
-	//calculate the selection of the current node through pipeline
-	conseq, err := pipeline.Process(parent.getSelection(), node.getPipelines())
-	if err != nil {
-		node.addError(err)
-	}
-	node.Selection = conseq
-
-	return conseq
-}
-
-// getPipelines is used to copy the pipelines of node and render it
-func (node *GraphNode) getPipelines() pipeline.Pipelines {
-	var pipelines pipeline.Pipelines
-	for _, pipe := range node.Pipelines {
-		var args []string
-
-		switch pipe.Name {
-		// link pipeline has some particularities,
-		// it can refer to variables directly instead of {$variable} in strings
-		case "link":
-			if len(pipe.Args) != 1 {
-				node.addError(fmt.Sprintf(ErrWrongArgNumber,
-					"link", 1, len(pipe.Args),
-				))
-				continue
-			}
-			reference := ""
-			varname := pipe.Args[0]
-			if varname == node.Name {
-				continue
-			}
-			if conseq := node.lookUp(varname); conseq != nil {
-				reference = conseq.String()
-			}
-			args = append(args, reference)
-
-		default:
-			// other pipeline
-			for _, arg := range pipe.Args {
-				args = append(args, node.render(arg))
-			}
-		}
-
-		// A copy of a variable rendered pipeline.
-		pipelines = append(pipelines, &pipeline.Pipeline{
-			Name: pipe.Name,
-			Args: args,
-		})
-	}
-	return pipelines
-}
-
-//render function replaces the magic variable in the passed string with variable value
-func (node *GraphNode) render(s string) string {
-	//TODO: evaluate without regexp
-	expr := regexp.MustCompile(`{\$(.*?)}`)
-	matches := expr.FindAllStringSubmatch(s, -1)
-
-	offset := 0
-
-	for _, match := range matches {
-		//in fact, it is impossible.
-		if len(match) != 2 {
-			continue
-		}
-
-		template, varname := match[0], match[1]
-
-		var value string
-		//reference self
-		if varname == "" || varname == node.Name {
-			//it will change dynamically, throw it to pipeline.
-			value = pipeline.InvokePlaceholder
-
-		} else if conseq := node.lookUp(varname); conseq != nil {
-			// referenced to other variables
-			value = conseq.String()
-
-		} else {
-			// failed to find the variable described
-			continue
-		}
-
-		s = strings.Replace(s, template, value, 1)
-		offset += len(value) - len(template)
-
-	}
-
-	return s
-}
-
-// lookUp searches for the node from the previous sibling node and all parent nodes.
-func (node *GraphNode) lookUp(name string) (conseq *GraphNode) {
-	if conseq = node.prev(name); conseq == nil {
-		conseq = node.parents(name)
-	}
-	return
-}
-
-// parents is used to locate nodes from parent,
-// including the siblings of parent and ancestor.
-func (node *GraphNode) parents(name string) *GraphNode {
-	if parent := node.Parent; parent != nil {
-		if siblings := parent.siblings(name); siblings != nil {
-			return siblings
-		}
-		return parent.parents(name)
-	}
-	return nil
-}
-
-// siblings is used to find brotherhood nodes.
-func (node *GraphNode) siblings(name string) *GraphNode {
-	if parent := node.Parent; parent != nil {
-		for _, child := range parent.Children {
-			if child.Name == name {
-				return child
-			}
-		}
-	}
-	return nil
-}
-
-// prev is used to find the sibling nodes before the current node.
-func (node *GraphNode) prev(name string) *GraphNode {
-	if parent := node.Parent; parent != nil {
-		for _, child := range node.Parent.Children {
-			switch child.Name {
-			case name:
-				return child
-			case node.Name: // if traverse the current node, return nil directly.
-				return nil
-			}
-		}
-	}
-	return nil
-}
-
 // getFirstChild is used to return the first child node.
 func (node *GraphNode) getFirstChild() *GraphNode {
 	if len(node.Children) > 0 {
@@ -301,14 +149,6 @@ func (node *GraphNode) getFirstChild() *GraphNode {
 	return nil
 }
 
-// String method of the node returns the Text of selection.
-func (node *GraphNode) String() string {
-	if selection := node.getSelection(); selection != nil {
-		return selection.Text()
-	}
-	return ""
-}
-
 // Each is used to traverse all the child nodes of the current node.
 func (node *GraphNode) each(iterator func(int, *GraphNode) bool) {
 	for i := 0; i < len(node.Children); i++ {
@@ -28,6 +28,8 @@ var json = jsoniter.ConfigCompatibleWithStandardLibrary
 type GraphResponse struct {
 	Data   GraphRawData `json:"data"`
 	Errors Errors       `json:"errors"`
+	// Defaults are the paths of the nodes whose default values are used, such as "items[0].price".
+	Defaults []string `json:"defaults,omitempty"`
 }
 
 func (response *GraphResponse) String() (conseq string) {
@@ -0,0 +1,208 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/storyicon/graphquery/kernel/selector"
+)
+
+// Limits bounds the resources used by a single parse.
+// A zero value of any field means no limit.
+type Limits struct {
+	// MaxElements is the maximum number of elements iterated by one TypeArray or TypeObjectArray node.
+	MaxElements int
+	// MaxValues is the maximum number of GraphData values produced in total.
+	MaxValues int
+	// MaxOutputBytes is the maximum length of the String or Text of any selection.
+	MaxOutputBytes int
+	// MaxProcessorCalls is the maximum number of processor invocations in total.
+	MaxProcessorCalls int
+}
+
+// Option configures a single parse of Graph.
+type Option func(*execution)
+
+const (
+	// ErrTooManyElements means an array node iterates too many elements
+	ErrTooManyElements = "limit exceeded: node %s iterates more than %d elements"
+	// ErrTooManyValues means too many values are produced
+	ErrTooManyValues = "limit exceeded: more than %d values are produced"
+	// ErrOutputTooLarge means the output of a selection is too large
+	ErrOutputTooLarge = "limit exceeded: selection outputs more than %d bytes"
+	// ErrTooManyProcessorCalls means too many processors are invoked
+	ErrTooManyProcessorCalls = "limit exceeded: more than %d processor invocations"
+)
+
+// WithLimits sets the resource limits of the parse,
+// the parse stops with an error in GraphResponse.Errors when any of them is hit.
+func WithLimits(limits Limits) Option {
+	return func(exec *execution) {
+		exec.limits = limits
+	}
+}
+
+// countValue counts a produced value, it reports false when MaxValues is exceeded.
+func (exec *execution) countValue() bool {
+	exec.values++
+	if max := exec.limits.MaxValues; max > 0 && exec.values > max {
+		exec.stop(fmt.Sprintf(ErrTooManyValues, max))
+		return false
+	}
+	return true
+}
+
+// countCalls counts the processors to be invoked, it reports false when MaxProcessorCalls is exceeded.
+func (exec *execution) countCalls(n int) bool {
+	exec.calls += n
+	if max := exec.limits.MaxProcessorCalls; max > 0 && exec.calls > max {
+		exec.stop(fmt.Sprintf(ErrTooManyProcessorCalls, max))
+		return false
+	}
+	return true
+}
+
+// checkElement reports false when node iterates more than MaxElements elements.
+func (exec *execution) checkElement(node *GraphNode, index int) bool {
+	if max := exec.limits.MaxElements; max > 0 && index >= max {
+		exec.stop(fmt.Sprintf(ErrTooManyElements, node.Name, max))
+		return false
+	}
+	return true
+}
+
+// limit wraps the selection so that its output is checked against MaxOutputBytes.
+func (exec *execution) limit(selection selector.Selection) selector.Selection {
+	if selection == nil || exec.limits.MaxOutputBytes <= 0 {
+		return selection
+	}
+	if _, limited := selection.(*limitedSelection); limited {
+		return selection
+	}
+	return &limitedSelection{
+		Selection: selection,
+		exec:      exec,
+	}
+}
+
+// limitedSelection is a Selection whose String and Text are bounded by MaxOutputBytes,
+// the selections derived from it are bounded too.
+type limitedSelection struct {
+	selector.Selection
+	exec *execution
+}
+
+// the compiled queries of the bound pipelines are applied to the limited selections too
+var _ selector.QueryFinder = &limitedSelection{}
+
+func (selection *limitedSelection) Find(expr string) (selector.Selection, error) {
+	conseq, err := selection.Selection.Find(expr)
+	return selection.exec.limit(conseq), err
+}
+
+func (selection *limitedSelection) Type(typename string) (selector.Selection, error) {
+	conseq, err := selection.Selection.Type(typename)
+	return selection.exec.limit(conseq), err
+}
+
+func (selection *limitedSelection) Eq(index int) (selector.Selection, error) {
+	conseq, err := selection.Selection.Eq(index)
+	return selection.exec.limit(conseq), err
+}
+
+func (selection *limitedSelection) Each(iterator func(int, selector.Selection) bool) error {
+	return selection.Selection.Each(func(i int, element selector.Selection) bool {
+		return iterator(i, selection.exec.limit(element))
+	})
+}
+
+// FindQuery forwards the compiled query to the wrapped selection, see selector.FindQuery.
+func (selection *limitedSelection) FindQuery(query *selector.Query) (selector.Selection, error) {
+	conseq, err := selector.FindQuery(selection.Selection, query)
+	return selection.exec.limit(conseq), err
+}
+
+func (selection *limitedSelection) String() string {
+	if writer, ok := selection.Selection.(selector.OutputWriter); ok {
+		return selection.output(writer.OutputString)
+	}
+	return selection.check(selection.Selection.String())
+}
+
+func (selection *limitedSelection) Text() string {
+	if writer, ok := selection.Selection.(selector.OutputWriter); ok {
+		return selection.output(writer.OutputText)
+	}
+	return selection.check(selection.Selection.Text())
+}
+
+// output builds the output written by write, the building is stopped as soon as it is too large,
+// so that a large output is not built before it is dropped.
+func (selection *limitedSelection) output(write func(writer io.Writer) error) string {
+	builder := &limitedBuilder{max: selection.exec.limits.MaxOutputBytes}
+	if err := write(builder); err != nil {
+		return selection.exceed()
+	}
+	return builder.String()
+}
+
+// check stops the execution and drops the output when it is too large.
+func (selection *limitedSelection) check(output string) string {
+	if len(output) > selection.exec.limits.MaxOutputBytes {
+		return selection.exceed()
+	}
+	return output
+}
+
+// exceed stops the execution for the output which is too large, the output is dropped.
+func (selection *limitedSelection) exceed() string {
+	selection.exec.truncated = true
+	selection.exec.stop(fmt.Sprintf(ErrOutputTooLarge, selection.exec.limits.MaxOutputBytes))
+	return ""
+}
+
+// errOutputTooLarge is returned by limitedBuilder when the output is too large.
+var errOutputTooLarge = errors.New("output too large")
+
+// limitedBuilder is a strings.Builder which fails instead of writing more than max bytes.
+type limitedBuilder struct {
+	strings.Builder
+	max int
+}
+
+func (builder *limitedBuilder) Write(p []byte) (int, error) {
+	if builder.Len()+len(p) > builder.max {
+		return 0, errOutputTooLarge
+	}
+	return builder.Builder.Write(p)
+}
+
+func (builder *limitedBuilder) WriteString(s string) (int, error) {
+	if builder.Len()+len(s) > builder.max {
+		return 0, errOutputTooLarge
+	}
+	return builder.Builder.WriteString(s)
+}
+
+func (builder *limitedBuilder) WriteByte(c byte) error {
+	if builder.Len() >= builder.max {
+		return errOutputTooLarge
+	}
+	return builder.Builder.WriteByte(c)
+}
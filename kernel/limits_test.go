@@ -0,0 +1,165 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/storyicon/graphquery/kernel/pipeline"
+	"github.com/storyicon/graphquery/kernel/selector"
+)
+
+func TestGraph_Parse_Limits(t *testing.T) {
+	graph := &Graph{
+		Root: &GraphNode{
+			Name: "__ROOT__",
+		},
+		Nodes: []*GraphNode{
+			{
+				Name: "title",
+				Pipelines: []*pipeline.Pipeline{
+					{
+						Name: "css",
+						Args: []string{".title"},
+					},
+				},
+			},
+			{
+				Name:     "items",
+				NodeType: TypeArray,
+				Pipelines: []*pipeline.Pipeline{
+					{
+						Name: "css",
+						Args: []string{".item"},
+					},
+				},
+				Children: []*GraphNode{
+					{
+						Name: "item",
+						Pipelines: []*pipeline.Pipeline{
+							{
+								Name: "text",
+							},
+							{
+								Name: "trim",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	document := `<p class="title">Title</p><p class="item">a</p><p class="item">b</p><p class="item">c</p>`
+	tests := []struct {
+		name   string
+		limits Limits
+		want   string
+	}{
+		{
+			name: "test0",
+			want: `{"data":{"items":["a","b","c"],"title":"Title"},"errors":null}`,
+		},
+		{
+			name: "test1",
+			limits: Limits{
+				MaxElements: 3,
+				MaxValues:   5,
+			},
+			want: `{"data":{"items":["a","b","c"],"title":"Title"},"errors":null}`,
+		},
+		{
+			name: "test2",
+			limits: Limits{
+				MaxElements: 2,
+			},
+			want: `{"data":{"items":["a","b"],"title":"Title"},"errors":["limit exceeded: node items iterates more than 2 elements"]}`,
+		},
+		{
+			name: "test3",
+			limits: Limits{
+				MaxValues: 3,
+			},
+			want: `{"data":{"items":["a"],"title":"Title"},"errors":["limit exceeded: more than 3 values are produced"]}`,
+		},
+		{
+			name: "test4",
+			limits: Limits{
+				MaxProcessorCalls: 4,
+			},
+			want: `{"data":{"items":["a"],"title":"Title"},"errors":["limit exceeded: more than 4 processor invocations"]}`,
+		},
+		{
+			name: "test5",
+			limits: Limits{
+				MaxOutputBytes: 4,
+			},
+			want: `{"data":{},"errors":["limit exceeded: selection outputs more than 4 bytes"]}`,
+		},
+	}
+	for _, tt := range tests {
+		if got := graph.Parse(document, WithLimits(tt.limits)).String(); got != tt.want {
+			t.Errorf("%q. Graph.Parse() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// chunkedSelection writes its output in chunks and counts the chunks written.
+type chunkedSelection struct {
+	selector.Selection
+	chunks  int
+	written int
+}
+
+func (selection *chunkedSelection) OutputString(writer io.Writer) error {
+	for i := 0; i < selection.chunks; i++ {
+		if _, err := io.WriteString(writer, "ab"); err != nil {
+			return err
+		}
+		selection.written++
+	}
+	return nil
+}
+
+func (selection *chunkedSelection) OutputText(writer io.Writer) error {
+	return selection.OutputString(writer)
+}
+
+func TestLimitedSelection_Output(t *testing.T) {
+	tests := []struct {
+		name        string
+		chunks      int
+		want        string
+		wantWritten int
+	}{
+		{name: "test0", chunks: 2, want: "abab", wantWritten: 2},
+		{name: "test1", chunks: 1000, want: "", wantWritten: 2},
+	}
+	for _, tt := range tests {
+		exec := newExecution(context.Background(), &Graph{}, WithLimits(Limits{MaxOutputBytes: 5}))
+		selection := &chunkedSelection{chunks: tt.chunks}
+		if got := exec.limit(selection).String(); got != tt.want {
+			t.Errorf("%q. limitedSelection.String() = %q, want %q", tt.name, got, tt.want)
+		}
+		// the output is not built any further once it is too large
+		if selection.written != tt.wantWritten {
+			t.Errorf("%q. limitedSelection.String() written = %v, want %v", tt.name, selection.written, tt.wantWritten)
+		}
+		if got, want := exec.truncated, tt.want == ""; got != want {
+			t.Errorf("%q. execution.truncated = %v, want %v", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ListOperators are the operators applied to the elements of an array node after they are filtered,
+// such as `unique by id sort by price numeric desc offset 10 limit 20`.
+// They are applied in the order of Unique, Sort, Reverse, Offset and Limit.
+type ListOperators struct {
+	// Unique drops the elements whose key appeared in the elements before them,
+	// UniqueBy is the name of the child used as the key, the whole element is the key when it is empty.
+	Unique   bool
+	UniqueBy string
+	// Sort sorts the elements stably by the child named SortBy,
+	// the elements of an array are sorted by their values when it is empty.
+	Sort       bool
+	SortBy     string
+	SortMode   string
+	Descending bool
+	// Reverse reverses the order of the elements.
+	Reverse bool
+	// Offset is the number of the elements skipped,
+	// Limit is the max number of the elements kept, there is no limit when it is not positive.
+	Offset int
+	Limit  int
+}
+
+const (
+	// SortString compares the values as strings, it is the default mode
+	SortString = "string"
+	// SortNumeric compares the values as numbers, the values which are not numbers are sorted last
+	SortNumeric = "numeric"
+	// SortNatural compares the digits in the values as numbers, so that "item2" is before "item10"
+	SortNatural = "natural"
+)
+
+// IsSortMode reports whether mode is one of the sort modes.
+func IsSortMode(mode string) bool {
+	switch mode {
+	case SortString, SortNumeric, SortNatural:
+		return true
+	}
+	return false
+}
+
+// ordered reports whether the order of the elements is changed,
+// in which case all the elements are collected before they are arranged.
+func (list *ListOperators) ordered() bool {
+	return list.Sort || list.Reverse
+}
+
+// uniqueKey returns the key of the element whose children have the values.
+func (list *ListOperators) uniqueKey(children []*GraphNode, values []*GraphData) string {
+	var conseq []GraphRawData
+	for j, value := range values {
+		if list.UniqueBy == "" || children[j].Name == list.UniqueBy {
+			conseq = append(conseq, value.Output())
+		}
+	}
+	key, _ := json.MarshalToString(conseq)
+	return key
+}
+
+// arrange sorts, reverses and slices the collected elements,
+// it returns the indexes of the elements kept in the order they are output.
+func (list *ListOperators) arrange(children []*GraphNode, elements [][]*GraphData) []int {
+	indexes := make([]int, len(elements))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	if list.Sort {
+		keys := make([]operand, len(elements))
+		for i, values := range elements {
+			keys[i] = list.sortKey(children, values)
+		}
+		sort.SliceStable(indexes, func(a, b int) bool {
+			return list.less(keys[indexes[a]], keys[indexes[b]])
+		})
+	}
+	if list.Reverse {
+		for i, j := 0, len(indexes)-1; i < j; i, j = i+1, j-1 {
+			indexes[i], indexes[j] = indexes[j], indexes[i]
+		}
+	}
+	if list.Offset >= len(indexes) {
+		return nil
+	}
+	if list.Offset > 0 {
+		indexes = indexes[list.Offset:]
+	}
+	if list.Limit > 0 && list.Limit < len(indexes) {
+		indexes = indexes[:list.Limit]
+	}
+	return indexes
+}
+
+// sortKey returns the value of the element which it is sorted by.
+func (list *ListOperators) sortKey(children []*GraphNode, values []*GraphData) operand {
+	for j, value := range values {
+		if list.SortBy == "" || children[j].Name == list.SortBy {
+			key := operandOf(value)
+			if list.SortMode == SortNumeric && !key.numeric {
+				number, err := strconv.ParseFloat(strings.TrimSpace(key.text), 64)
+				key.number, key.numeric, key.null = number, err == nil, key.null || err != nil
+			}
+			return key
+		}
+	}
+	return operand{null: true}
+}
+
+// less reports whether the element with the key a is sorted before the one with the key b,
+// the null keys are sorted last in both directions.
+func (list *ListOperators) less(a operand, b operand) bool {
+	if a.null || b.null {
+		return !a.null
+	}
+	var conseq int
+	switch list.SortMode {
+	case SortNumeric:
+		switch {
+		case a.number < b.number:
+			conseq = -1
+		case a.number > b.number:
+			conseq = 1
+		}
+	case SortNatural:
+		conseq = naturalCompare(a.text, b.text)
+	default:
+		conseq = strings.Compare(a.text, b.text)
+	}
+	if list.Descending {
+		return conseq > 0
+	}
+	return conseq < 0
+}
+
+// naturalCompare compares the strings like strings.Compare,
+// but the runs of digits in them are compared as numbers.
+func naturalCompare(a string, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			x, y := digits(a), digits(b)
+			// the leading zeros do not change the number
+			m, n := strings.TrimLeft(a[:x], "0"), strings.TrimLeft(b[:y], "0")
+			if len(m) != len(n) {
+				return compareInt(len(m), len(n))
+			}
+			if conseq := strings.Compare(m, n); conseq != 0 {
+				return conseq
+			}
+			a, b = a[x:], b[y:]
+			continue
+		}
+		if a[0] != b[0] {
+			return compareInt(int(a[0]), int(b[0]))
+		}
+		a, b = a[1:], b[1:]
+	}
+	return compareInt(len(a), len(b))
+}
+
+// digits returns the length of the run of digits at the beginning of str.
+func digits(str string) int {
+	i := 0
+	for i < len(str) && isDigit(str[i]) {
+		i++
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func compareInt(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,41 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+)
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want int
+	}{
+		{name: "test0", a: "item2", b: "item10", want: -1},
+		{name: "test1", a: "item10", b: "item2", want: 1},
+		{name: "test2", a: "item02", b: "item2", want: 0},
+		{name: "test3", a: "a1b2", b: "a1b10", want: -1},
+		{name: "test4", a: "abc", b: "abd", want: -1},
+		{name: "test5", a: "v1", b: "v1.5", want: -1},
+		{name: "test6", a: "", b: "1", want: -1},
+	}
+	for _, tt := range tests {
+		if got := naturalCompare(tt.a, tt.b); got != tt.want {
+			t.Errorf("%q. naturalCompare() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -15,6 +15,8 @@
 package pipeline
 
 import (
+	"context"
+	"errors"
 	"strings"
 
 	"github.com/storyicon/graphquery/kernel/selector"
@@ -23,18 +25,60 @@ import (
 const (
 	// InvokePlaceholder is used for its own replacement.
 	// When InvokePlaceholder appears in args, it will be replaced by the string of its own node.
-	InvokePlaceholder = string(26) + "{$}" + string(26)
+	InvokePlaceholder = "\x1a{$}\x1a"
+	// RootFunc is the name of the pipeline which processes its sub-pipeline against the document root,
+	// such as root(css("base");attr("href")), root() returns the document root itself.
+	RootFunc = "root"
+)
+
+const (
+	// ErrRootArgs means root is called with a wrong parameter
+	ErrRootArgs = "method root expects a pipeline as its parameter"
 )
 
 // Pipeline structure is the calling unit in pipeline.
 type Pipeline struct {
 	Name string
 	Args []string
+	// Exprs are the sub-pipelines of the arguments, such as link("separator") in replace(" ", link("separator")).
+	// Exprs[i] is processed against the selection of the pipeline and the text of its result is Args[i],
+	// it is nil for a string argument. Exprs is nil when all the arguments are strings.
+	Exprs []Pipelines
+	// bound are the arguments converted by Registry.Bind for the processor with the signature.
+	bound     Args
+	signature *Signature
+}
+
+// Bound reports whether the arguments of pipe are converted by Registry.Bind in advance,
+// the arguments of a bound pipeline are known before it is processed.
+func (pipe *Pipeline) Bound() bool {
+	return pipe.signature != nil
 }
 
 // Pipelines defines the entire pipeline process of a selection.
 type Pipelines []*Pipeline
 
+// Calls returns the number of the pipelines, including the ones in the arguments.
+func (pipes Pipelines) Calls() (conseq int) {
+	for _, pipe := range pipes {
+		conseq++
+		for _, expr := range pipe.Exprs {
+			conseq += expr.Calls()
+		}
+	}
+	return
+}
+
+// rootKey is the key of the document root in the context of processing.
+type rootKey struct{}
+
+// WithRoot returns a copy of ctx which carries the document root,
+// root() of the pipelines processed with it is evaluated against the root.
+// The selection passed to ProcessContext is the root when ctx does not carry one.
+func WithRoot(ctx context.Context, root selector.Selection) context.Context {
+	return context.WithValue(ctx, rootKey{}, root)
+}
+
 func invokePlaceholderRender(node selector.Selection, args []string) []string {
 	if len(args) == 0 {
 		return args
@@ -52,14 +96,85 @@ func invokePlaceholderRender(node selector.Selection, args []string) []string {
 	return args
 }
 
-// Process performs the entire pipeline process for selection
+// Process performs the entire pipeline process for selection with the processors of Default.
 func Process(selection selector.Selection, pipes Pipelines) (node selector.Selection, err error) {
+	return Default.ProcessContext(context.Background(), selection, pipes)
+}
+
+// ProcessContext is like Process, but stops before the next pipe when ctx is done.
+func ProcessContext(ctx context.Context, selection selector.Selection, pipes Pipelines) (node selector.Selection, err error) {
+	return Default.ProcessContext(ctx, selection, pipes)
+}
+
+// ProcessContext performs the entire pipeline process for selection with the processors of the registry,
+// it stops before the next pipe when ctx is done.
+func (registry *Registry) ProcessContext(ctx context.Context, selection selector.Selection, pipes Pipelines) (node selector.Selection, err error) {
+	if _, exists := ctx.Value(rootKey{}).(selector.Selection); !exists {
+		ctx = WithRoot(ctx, selection)
+	}
 	node = selection
 	for _, pipe := range pipes {
-		args := invokePlaceholderRender(node, pipe.Args)
-		if node, err = InvokeProcessor(node, pipe.Name, args); err != nil {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if pipe.Name == RootFunc {
+			if node, err = registry.processRoot(ctx, pipe); err != nil {
+				return
+			}
+			continue
+		}
+		// the arguments of a bound pipeline are not converted again
+		if pipe.Bound() {
+			conseq, invoked, e := registry.invokeBound(node, pipe)
+			if invoked {
+				if node, err = conseq, e; err != nil {
+					return
+				}
+				continue
+			}
+		}
+		var args []string
+		if args, err = registry.evaluate(ctx, node, pipe); err != nil {
+			return
+		}
+		args = invokePlaceholderRender(node, args)
+		if node, err = registry.Invoke(node, pipe.Name, args); err != nil {
 			return
 		}
 	}
 	return
 }
+
+// evaluate returns the arguments of pipe, the sub-pipelines in them are processed against node.
+func (registry *Registry) evaluate(ctx context.Context, node selector.Selection, pipe *Pipeline) ([]string, error) {
+	if pipe.Exprs == nil {
+		return pipe.Args, nil
+	}
+	args := make([]string, len(pipe.Args))
+	copy(args, pipe.Args)
+	for i, expr := range pipe.Exprs {
+		if expr == nil || i >= len(args) {
+			continue
+		}
+		conseq, err := registry.ProcessContext(ctx, node, expr)
+		if err != nil {
+			return nil, err
+		}
+		if args[i] = ""; conseq != nil {
+			args[i] = conseq.Text()
+		}
+	}
+	return args, nil
+}
+
+// processRoot processes the sub-pipeline of root() against the document root carried by ctx.
+func (registry *Registry) processRoot(ctx context.Context, pipe *Pipeline) (selector.Selection, error) {
+	root, _ := ctx.Value(rootKey{}).(selector.Selection)
+	switch {
+	case len(pipe.Args) == 0:
+		return root, nil
+	case len(pipe.Args) > 1 || len(pipe.Exprs) == 0 || pipe.Exprs[0] == nil:
+		return nil, errors.New(ErrRootArgs)
+	}
+	return registry.ProcessContext(ctx, root, pipe.Exprs[0])
+}
@@ -15,7 +15,13 @@
 package pipeline
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/storyicon/graphquery/kernel/selector"
 )
@@ -23,55 +29,455 @@ import (
 // Processor is the function call unit of pipeline.
 type Processor struct {
 	// Func is the function ontology.
-	Func Callee
-	// ArgsCount is the number of function parameters.
-	ArgsCount int
+	Func TypedCallee
+	// Signature describes the parameters of the function.
+	Signature *Signature
+	// Selection is the selection type which the processor converts the current node to,
+	// it is set for the selectors registered by RegistSelector.
+	Selection string
 }
 
-// Callee defines the function body of Processor.
+// Callee defines the function body of Processor whose parameters are all strings.
 type Callee func(selector.Selection, []string) (selector.Selection, error)
 
+// TypedCallee defines the function body of Processor,
+// the arguments it receives are converted to the types of the parameters in the signature.
+type TypedCallee func(selector.Selection, Args) (selector.Selection, error)
+
+// Signature describes the parameters of a Processor, such as `eq(index int)`.
+type Signature struct {
+	// Params are the parameters in order, the optional ones are after the required ones.
+	Params []Param
+	// Variadic reports whether the last parameter can be repeated zero or more times.
+	Variadic bool
+}
+
+// Param is a parameter of a Processor.
+type Param struct {
+	Name string
+	// Type is one of ArgString, ArgInt, ArgFloat, ArgBool, ArgRegex and ArgQuery,
+	// Selection is the selection type of the selectors accepted by an ArgQuery parameter.
+	Type      string
+	Selection string
+	// Optional reports whether the parameter can be omitted, Default is its value when it is omitted.
+	Optional bool
+	Default  string
+}
+
+const (
+	// ArgString is the type of the parameters which accept any string
+	ArgString = "string"
+	// ArgInt is the type of the parameters which accept integers, such as "-1"
+	ArgInt = "int"
+	// ArgFloat is the type of the parameters which accept numbers, such as "1.5"
+	ArgFloat = "float"
+	// ArgBool is the type of the parameters which accept "true" and "false"
+	ArgBool = "bool"
+	// ArgRegex is the type of the parameters which accept regular expressions
+	ArgRegex = "regex"
+	// ArgQuery is the type of the parameters which accept the selectors of a selection type, such as "div > a"
+	ArgQuery = "query"
+)
+
+// Arg is an argument converted to the type of its parameter,
+// String is the argument as it is received whatever the type is.
+type Arg struct {
+	String string
+	Int    int
+	Float  float64
+	Bool   bool
+	Regexp *regexp.Regexp
+	Query  *selector.Query
+}
+
+// Args are the arguments received by a TypedCallee, including the defaults of the omitted parameters.
+type Args []Arg
+
+// Strings returns the arguments as they are received.
+func (args Args) Strings() []string {
+	conseq := make([]string, len(args))
+	for i, arg := range args {
+		conseq[i] = arg.String
+	}
+	return conseq
+}
+
 const (
 	// ErrUndefinedMethod means method undefined
 	ErrUndefinedMethod = "undefined method: %s"
-	// ErrWrongArgNumber means wrong args number
-	ErrWrongArgNumber = "method %s expects %d parameters, but %d received"
+	// ErrArgsCount means a method is called with a wrong number of arguments
+	ErrArgsCount = "method %s expects %s, but %d received"
+	// ErrArgType means an argument can not be converted to the type of its parameter
+	ErrArgType = "parameter %s of method %s expects %s, but %q received"
+	// ErrArgRegex means an argument of a regex parameter is not a valid regular expression
+	ErrArgRegex = "parameter %s of method %s expects regex, %s"
+	// ErrArgQuery means an argument of a query parameter is not a valid selector
+	ErrArgQuery = "parameter %s of method %s expects %s selector, %s"
 	// ErrAlreadyExists means processor already exists
 	ErrAlreadyExists = "processor regist failed: %s already exists"
+	// ErrSignature means the signature of a processor is invalid
+	ErrSignature = "processor regist failed: %s, %s"
 )
 
-// _Registry stores all registered Processor.
-var _Registry = map[string]*Processor{}
+// Registry stores the processors which can be called in pipelines by name,
+// it is safe to register and invoke processors from multiple goroutines.
+type Registry struct {
+	mu         sync.RWMutex
+	processors map[string]*Processor
+}
+
+// Default is the registry of the built-in processors,
+// the pipelines of the graphs which are not bound to a registry are processed with it.
+// RegistProcessor and RegistTypedProcessor register processors with it.
+var Default = NewRegistry()
 
-func getProcessor(name string) *Processor {
-	if proc, exists := _Registry[name]; exists {
-		return proc
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		processors: map[string]*Processor{},
 	}
+}
+
+// Clone returns a copy of the registry, registering processors with the copy does not change the registry.
+func (registry *Registry) Clone() *Registry {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	conseq := NewRegistry()
+	for name, proc := range registry.processors {
+		conseq.processors[name] = proc
+	}
+	return conseq
+}
+
+// Lookup returns the processor registered with the name, it returns nil when there is none.
+func (registry *Registry) Lookup(name string) *Processor {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.processors[name]
+}
+
+// Names returns the names of the registered processors in order.
+func (registry *Registry) Names() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	names := make([]string, 0, len(registry.processors))
+	for name := range registry.processors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Regist is used to register a Processor which has argsCount required string parameters.
+func (registry *Registry) Regist(name string, callee Callee, argsCount int) error {
+	signature := &Signature{}
+	for i := 0; i < argsCount; i++ {
+		signature.Params = append(signature.Params, Param{
+			Name: "#" + strconv.Itoa(i+1),
+			Type: ArgString,
+		})
+	}
+	return registry.RegistTyped(name, signature, func(node selector.Selection, args Args) (selector.Selection, error) {
+		return callee(node, args.Strings())
+	})
+}
+
+// RegistTyped is used to register a Processor with its signature,
+// it fails when a processor with the name is already registered.
+func (registry *Registry) RegistTyped(name string, signature *Signature, callee TypedCallee) error {
+	return registry.regist(name, &Processor{Func: callee, Signature: signature}, false)
+}
+
+// Override is like RegistTyped, but it replaces the processor with the name if there is one.
+func (registry *Registry) Override(name string, signature *Signature, callee TypedCallee) error {
+	return registry.regist(name, &Processor{Func: callee, Signature: signature}, true)
+}
+
+func (registry *Registry) regist(name string, proc *Processor, override bool) error {
+	if err := proc.Signature.check(); err != nil {
+		return fmt.Errorf(ErrSignature, name, err)
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, exists := registry.processors[name]; exists && !override {
+		return fmt.Errorf(ErrAlreadyExists, name)
+	}
+	registry.processors[name] = proc
 	return nil
 }
 
-// RegistProcessor is used to register a Processor with the registry.
-func RegistProcessor(name string, callee Callee, argsCount int) error {
-	if getProcessor(name) != nil {
+// Deny removes the processors with the names from the registry,
+// the pipelines calling them fail to compile with the registry, such as regex() for a sandboxed tenant.
+func (registry *Registry) Deny(names ...string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, name := range names {
+		delete(registry.processors, name)
+	}
+}
+
+// Invoke is used to invoke a Processor of the registry.
+func (registry *Registry) Invoke(node selector.Selection, name string, args []string) (selector.Selection, error) {
+	proc := registry.Lookup(name)
+	if proc == nil {
+		return nil, fmt.Errorf(ErrUndefinedMethod, name)
+	}
+	conseq, err := proc.Signature.Bind(name, args)
+	if err != nil {
+		return nil, err
+	}
+	return proc.Func(node, conseq)
+}
+
+// invokeBound invokes the processor of pipe with the arguments bound to it by Bind,
+// it reports false when the processor is changed after pipe is bound.
+func (registry *Registry) invokeBound(node selector.Selection, pipe *Pipeline) (selector.Selection, bool, error) {
+	proc := registry.Lookup(pipe.Name)
+	if proc == nil || proc.Signature != pipe.signature {
+		return nil, false, nil
+	}
+	conseq, err := proc.Func(node, pipe.bound)
+	return conseq, true, err
+}
+
+// Check checks that the processor of pipe is registered, the number of the arguments of pipe
+// and the types of the ones known before it is processed, which are neither sub-pipelines nor strings with variables.
+func (registry *Registry) Check(pipe *Pipeline) error {
+	_, _, err := registry.convert(pipe)
+	return err
+}
+
+// Bind checks pipe like Check, and binds the converted arguments to pipe when all of them are known
+// before it is processed, so that they are not converted again every time pipe is processed,
+// such as the compiled selector of css("div > a"). Bind should not be called while pipe is being processed.
+func (registry *Registry) Bind(pipe *Pipeline) error {
+	args, signature, err := registry.convert(pipe)
+	if err != nil {
+		return err
+	}
+	pipe.bound, pipe.signature = nil, nil
+	if signature != nil && len(args) == len(pipe.Args) {
+		if pipe.bound, err = signature.bindDefaults(pipe.Name, args, len(args)); err != nil {
+			return err
+		}
+		pipe.signature = signature
+	}
+	return nil
+}
+
+// convert converts the arguments of pipe which are known before it is processed,
+// the signature is returned only when all of them are known.
+func (registry *Registry) convert(pipe *Pipeline) (Args, *Signature, error) {
+	if pipe.Name == RootFunc {
+		return nil, nil, nil
+	}
+	proc := registry.Lookup(pipe.Name)
+	if proc == nil {
+		return nil, nil, fmt.Errorf(ErrUndefinedMethod, pipe.Name)
+	}
+	signature := proc.Signature
+	if err := signature.checkCount(pipe.Name, len(pipe.Args)); err != nil {
+		return nil, nil, err
+	}
+	var conseq Args
+	known := true
+	for i, arg := range pipe.Args {
+		if i < len(pipe.Exprs) && pipe.Exprs[i] != nil || strings.Contains(arg, "{$") || strings.Contains(arg, InvokePlaceholder) {
+			known = false
+			continue
+		}
+		value, err := signature.param(i).convert(pipe.Name, arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		conseq = append(conseq, value)
+	}
+	if !known {
+		return nil, nil, nil
+	}
+	return conseq, signature, nil
+}
+
+// RegistSelector registers a processor named name, which selects the elements described by its expr parameter
+// from the current node converted to the selection type, like css("a") does for selector.TypeCSS.
+func (registry *Registry) RegistSelector(name string, typename string) error {
+	return registry.regist(name, selectorProcessor(typename), false)
+}
+
+// RegistSelection registers the factory of a selection type with the selector package,
+// and the processor named name selecting the elements of the type with the registry, see RegistSelector.
+// Nothing is registered when either the name or the type already exists.
+func (registry *Registry) RegistSelection(name string, typename string, factory selector.Factory) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, exists := registry.processors[name]; exists {
 		return fmt.Errorf(ErrAlreadyExists, name)
 	}
-	_Registry[name] = &Processor{
-		Func:      callee,
-		ArgsCount: argsCount,
+	if err := selector.RegistSelection(typename, factory); err != nil {
+		return err
 	}
+	registry.processors[name] = selectorProcessor(typename)
 	return nil
 }
 
-// InvokeProcessor is used to invoke a Processor.
+// selectorProcessor returns the processor selecting the elements of the selection type.
+func selectorProcessor(typename string) *Processor {
+	return &Processor{
+		Func:      calleeSelector(typename),
+		Signature: &Signature{Params: []Param{{Name: "expr", Type: ArgQuery, Selection: typename}}},
+		Selection: typename,
+	}
+}
+
+// RegistSelection is used to register a selection type and the processor selecting its elements with Default,
+// see Registry.RegistSelection.
+func RegistSelection(name string, typename string, factory selector.Factory) error {
+	return Default.RegistSelection(name, typename, factory)
+}
+
+// RegistProcessor is used to register a Processor with Default,
+// the processor has argsCount required string parameters.
+func RegistProcessor(name string, callee Callee, argsCount int) error {
+	return Default.Regist(name, callee, argsCount)
+}
+
+// RegistTypedProcessor is used to register a Processor with its signature with Default.
+func RegistTypedProcessor(name string, signature *Signature, callee TypedCallee) error {
+	return Default.RegistTyped(name, signature, callee)
+}
+
+// InvokeProcessor is used to invoke a Processor of Default.
 func InvokeProcessor(node selector.Selection, name string, args []string) (selector.Selection, error) {
-	proc := getProcessor(name)
-	if proc == nil {
-		return nil, fmt.Errorf(ErrUndefinedMethod, name)
+	return Default.Invoke(node, name, args)
+}
+
+// Bind converts the arguments of the method to the types of the parameters,
+// the defaults of the omitted optional parameters are appended.
+func (signature *Signature) Bind(method string, args []string) (Args, error) {
+	if err := signature.checkCount(method, len(args)); err != nil {
+		return nil, err
+	}
+	conseq := make(Args, 0, len(signature.Params))
+	for i, arg := range args {
+		value, err := signature.param(i).convert(method, arg)
+		if err != nil {
+			return nil, err
+		}
+		conseq = append(conseq, value)
+	}
+	return signature.bindDefaults(method, conseq, len(args))
+}
+
+// bindDefaults appends the defaults of the parameters omitted by the count arguments to args.
+func (signature *Signature) bindDefaults(method string, args Args, count int) (Args, error) {
+	for i := count; i < len(signature.Params); i++ {
+		param := signature.Params[i]
+		if signature.Variadic && i == len(signature.Params)-1 {
+			break
+		}
+		value, err := param.convert(method, param.Default)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	return args, nil
+}
+
+// param returns the parameter which receives the ith argument.
+func (signature *Signature) param(i int) Param {
+	if i >= len(signature.Params) {
+		return signature.Params[len(signature.Params)-1]
+	}
+	return signature.Params[i]
+}
+
+// checkCount checks that the method with the signature can be called with count arguments.
+func (signature *Signature) checkCount(method string, count int) error {
+	min, max := 0, len(signature.Params)
+	for i, param := range signature.Params {
+		if !param.Optional && !(signature.Variadic && i == max-1) {
+			min = i + 1
+		}
 	}
-	if len(args) != proc.ArgsCount {
-		return nil, fmt.Errorf(ErrWrongArgNumber,
-			name, proc.ArgsCount, len(args),
-		)
+	var expect string
+	switch {
+	case signature.Variadic && count >= min:
+		return nil
+	case count >= min && count <= max:
+		return nil
+	case signature.Variadic:
+		expect = "at least " + plural(min)
+	case min == max:
+		expect = plural(max)
+	default:
+		expect = strconv.Itoa(min) + " to " + plural(max)
+	}
+	return fmt.Errorf(ErrArgsCount, method, expect, count)
+}
+
+// check checks that the parameters have known types, the optional parameters are after the required ones,
+// and the defaults can be converted to the types.
+func (signature *Signature) check() error {
+	if signature.Variadic && len(signature.Params) == 0 {
+		return errors.New("variadic signature without parameters")
+	}
+	optional := false
+	for i, param := range signature.Params {
+		switch param.Type {
+		case ArgString, ArgInt, ArgFloat, ArgBool, ArgRegex, ArgQuery:
+		default:
+			return fmt.Errorf("undefined type %q of parameter %s", param.Type, param.Name)
+		}
+		if param.Type == ArgQuery && !selector.IsType(param.Selection) {
+			return fmt.Errorf("undefined selection type %q of parameter %s", param.Selection, param.Name)
+		}
+		if signature.Variadic && i == len(signature.Params)-1 {
+			break
+		}
+		if !param.Optional {
+			if optional {
+				return fmt.Errorf("required parameter %s follows optional parameters", param.Name)
+			}
+			continue
+		}
+		optional = true
+		if _, err := param.convert("", param.Default); err != nil {
+			return fmt.Errorf("invalid default %q of parameter %s", param.Default, param.Name)
+		}
+	}
+	return nil
+}
+
+// convert converts the argument to the type of the parameter.
+func (param Param) convert(method string, arg string) (conseq Arg, err error) {
+	conseq.String = arg
+	switch param.Type {
+	case ArgInt:
+		conseq.Int, err = strconv.Atoi(strings.TrimSpace(arg))
+	case ArgFloat:
+		conseq.Float, err = strconv.ParseFloat(strings.TrimSpace(arg), 64)
+	case ArgBool:
+		conseq.Bool, err = strconv.ParseBool(strings.TrimSpace(arg))
+	case ArgRegex:
+		if conseq.Regexp, err = regexp.Compile(arg); err != nil {
+			return conseq, fmt.Errorf(ErrArgRegex, param.Name, method, err)
+		}
+	case ArgQuery:
+		if conseq.Query, err = selector.CompileQuery(param.Selection, arg); err != nil {
+			return conseq, fmt.Errorf(ErrArgQuery, param.Name, method, param.Selection, err)
+		}
+	}
+	if err != nil {
+		return conseq, fmt.Errorf(ErrArgType, param.Name, method, param.Type, arg)
+	}
+	return
+}
+
+// plural returns the number of the parameters, such as "1 parameter" and "2 parameters".
+func plural(count int) string {
+	if count == 1 {
+		return "1 parameter"
 	}
-	return proc.Func(node, args)
+	return strconv.Itoa(count) + " parameters"
 }
@@ -0,0 +1,230 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/storyicon/graphquery/kernel/selector"
+)
+
+func TestSignature_Bind(t *testing.T) {
+	signature := &Signature{
+		Params: []Param{
+			{Name: "index", Type: ArgInt},
+			{Name: "ratio", Type: ArgFloat, Optional: true, Default: "0.5"},
+			{Name: "flags", Type: ArgBool},
+		},
+		Variadic: true,
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		want    Args
+		wantErr string
+	}{
+		{
+			name: "test0",
+			args: []string{"1"},
+			want: Args{{String: "1", Int: 1}, {String: "0.5", Float: 0.5}},
+		},
+		{
+			name: "test1",
+			args: []string{"-2", "1.5", "true", "false"},
+			want: Args{{String: "-2", Int: -2}, {String: "1.5", Float: 1.5}, {String: "true", Bool: true}, {String: "false"}},
+		},
+		{
+			name:    "test2",
+			args:    nil,
+			wantErr: "method f expects at least 1 parameter, but 0 received",
+		},
+		{
+			name:    "test3",
+			args:    []string{"1", "x"},
+			wantErr: `parameter ratio of method f expects float, but "x" received`,
+		},
+		{
+			name:    "test4",
+			args:    []string{"1", "1", "true", "yes"},
+			wantErr: `parameter flags of method f expects bool, but "yes" received`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := signature.Bind("f", tt.args)
+		if err != nil {
+			if err.Error() != tt.wantErr {
+				t.Errorf("%q. Signature.Bind() error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if tt.wantErr != "" || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q. Signature.Bind() = %v, want %v, %v", tt.name, got, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRegistTypedProcessor(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature *Signature
+		wantErr   string
+	}{
+		{
+			name:      "test0",
+			signature: &Signature{Params: []Param{{Name: "a", Type: "date"}}},
+			wantErr:   `processor regist failed: test0, undefined type "date" of parameter a`,
+		},
+		{
+			name:      "test1",
+			signature: &Signature{Params: []Param{{Name: "a", Type: ArgInt, Optional: true, Default: "1"}, {Name: "b", Type: ArgInt}}},
+			wantErr:   "processor regist failed: test1, required parameter b follows optional parameters",
+		},
+		{
+			name:      "test2",
+			signature: &Signature{Params: []Param{{Name: "a", Type: ArgInt, Optional: true}}},
+			wantErr:   `processor regist failed: test2, invalid default "" of parameter a`,
+		},
+		{
+			name:      "css",
+			signature: &Signature{},
+			wantErr:   "processor regist failed: css already exists",
+		},
+	}
+	for _, tt := range tests {
+		if err := RegistTypedProcessor(tt.name, tt.signature, nil); err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%q. RegistTypedProcessor() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRegistry_Clone(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegistTyped("a", signatureOf(), calleeText)
+	cloned := registry.Clone()
+	cloned.RegistTyped("b", signatureOf("name", ArgString), calleeAttr)
+	cloned.Deny("a")
+	if err := cloned.Override("b", signatureOf(), calleeText); err != nil {
+		t.Errorf("Registry.Override() error = %v", err)
+	}
+	if err := cloned.Regist("b", func(node selector.Selection, args []string) (selector.Selection, error) {
+		return node, nil
+	}, 0); err == nil {
+		t.Errorf("Registry.Regist() overrides the processor registered")
+	}
+	tests := []struct {
+		name     string
+		registry *Registry
+		want     []string
+	}{
+		{
+			name:     "test0",
+			registry: registry,
+			want:     []string{"a"},
+		},
+		{
+			name:     "test1",
+			registry: cloned,
+			want:     []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.registry.Names(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q. Registry.Names() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if err := cloned.Check(&Pipeline{Name: "b"}); err != nil {
+		t.Errorf("Registry.Check() error = %v", err)
+	}
+	if err := cloned.Check(&Pipeline{Name: "a"}); err == nil || err.Error() != "undefined method: a" {
+		t.Errorf("Registry.Check() error = %v, want undefined method: a", err)
+	}
+}
+
+// logfmtTypes is the number of the selection types registered by TestRegistSelection.
+var logfmtTypes int
+
+func TestRegistSelection(t *testing.T) {
+	// logfmt records, such as `level=info msg=started`, are selected as JSON objects
+	factory := func(document string) (selector.Selection, error) {
+		record := map[string]string{}
+		for _, field := range strings.Fields(document) {
+			if i := strings.Index(field, "="); i > 0 {
+				record[field[:i]] = field[i+1:]
+			}
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		return selector.NewSelection(selector.TypeJSON, string(data))
+	}
+	// the selection types are global, every run registers a type of its own
+	logfmtTypes++
+	typename := fmt.Sprintf("LOGFMT%d", logfmtTypes)
+	registry := Default.Clone()
+	if err := registry.RegistSelection("logfmt", typename, factory); err != nil {
+		t.Fatalf("Registry.RegistSelection() error = %v", err)
+	}
+	if err := registry.RegistSelection("logfmt", typename+"X", factory); err == nil {
+		t.Errorf("Registry.RegistSelection() registers logfmt twice")
+	}
+	if selector.IsType(typename + "X") {
+		t.Errorf("Registry.RegistSelection() registers %s with an existing name", typename+"X")
+	}
+	if err := registry.RegistSelection("logfmt2", typename, factory); err == nil {
+		t.Errorf("Registry.RegistSelection() registers %s twice", typename)
+	}
+	if registry.Lookup("logfmt2") != nil {
+		t.Errorf("Registry.RegistSelection() registers logfmt2 with an existing type")
+	}
+	if Default.Lookup("logfmt") != nil {
+		t.Errorf("Registry.RegistSelection() registers logfmt with Default")
+	}
+	if err := NewRegistry().RegistSelector("proto", "PROTO"); err == nil || err.Error() != `processor regist failed: proto, undefined selection type "PROTO" of parameter expr` {
+		t.Errorf("Registry.RegistSelector() error = %v", err)
+	}
+	document, _ := selector.NewString("<p>level=info msg=started</p>")
+	tests := []struct {
+		name  string
+		pipes Pipelines
+		want  string
+	}{
+		{
+			name:  "test0",
+			pipes: Pipelines{{Name: "css", Args: []string{"p"}}, {Name: "text"}, {Name: "logfmt", Args: []string{"msg"}}},
+			want:  "started",
+		},
+		{
+			name:  "test1",
+			pipes: Pipelines{{Name: "css", Args: []string{"p"}}, {Name: "text"}, {Name: "logfmt", Args: []string{"level"}}, {Name: "template", Args: []string{"[" + InvokePlaceholder + "]"}}},
+			want:  "[info]",
+		},
+	}
+	for _, tt := range tests {
+		got, err := registry.ProcessContext(context.Background(), document, tt.pipes)
+		if err != nil {
+			t.Errorf("%q. Registry.ProcessContext() error = %v", tt.name, err)
+			continue
+		}
+		if got.Text() != tt.want {
+			t.Errorf("%q. Registry.ProcessContext() = %v, want %v", tt.name, got.Text(), tt.want)
+		}
+	}
+}
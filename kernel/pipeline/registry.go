@@ -16,93 +16,79 @@ package pipeline
 
 import (
 	"net/url"
-	"strconv"
 	"strings"
 
 	"github.com/storyicon/graphquery/kernel/selector"
 )
 
 func init() {
-	RegistProcessor("css", calleeCSS, 1)
-	RegistProcessor("json", calleeJSON, 1)
-	RegistProcessor("xpath", calleeXpath, 1)
-	RegistProcessor("regex", calleeRegex, 1)
-	RegistProcessor("trim", calleeTrim, 0)
-	RegistProcessor("template", calleeTemplate, 1)
-	RegistProcessor("attr", calleeAttr, 1)
-	RegistProcessor("eq", calleeEq, 1)
-	RegistProcessor("string", calleeString, 0)
-	RegistProcessor("text", calleeText, 0)
-	RegistProcessor("link", calleeLink, 1)
-	RegistProcessor("replace", calleeReplace, 2)
-	RegistProcessor("absolute", calleeAbsolute, 1)
+	Default.RegistSelector("css", selector.TypeCSS)
+	Default.RegistSelector("json", selector.TypeJSON)
+	Default.RegistSelector("xpath", selector.TypeXPATH)
+	Default.RegistSelector("regex", selector.TypeREGEX)
+	RegistTypedProcessor("trim", &Signature{Params: []Param{
+		{Name: "cutset", Type: ArgString, Optional: true},
+	}}, calleeTrim)
+	RegistTypedProcessor("template", signatureOf("template", ArgString), calleeTemplate)
+	RegistTypedProcessor("attr", signatureOf("name", ArgString), calleeAttr)
+	RegistTypedProcessor("eq", signatureOf("index", ArgInt), calleeEq)
+	RegistTypedProcessor("string", signatureOf(), calleeString)
+	RegistTypedProcessor("text", signatureOf(), calleeText)
+	RegistTypedProcessor("link", signatureOf("name", ArgString), calleeLink)
+	RegistTypedProcessor("replace", &Signature{Params: []Param{
+		{Name: "old", Type: ArgString},
+		{Name: "new", Type: ArgString},
+		{Name: "n", Type: ArgInt, Optional: true, Default: "-1"},
+	}}, calleeReplace)
+	RegistTypedProcessor("absolute", signatureOf("base", ArgString), calleeAbsolute)
 }
 
-func calleeCSS(node selector.Selection, args []string) (selection selector.Selection, err error) {
-	expr := args[0]
-
-	if selection, err = node.Type(selector.TypeCSS); err != nil {
-		return
-	}
-	return selection.Find(expr)
-}
-
-func calleeJSON(node selector.Selection, args []string) (selection selector.Selection, err error) {
-	expr := args[0]
-
-	if selection, err = node.Type(selector.TypeJSON); err != nil {
-		return
+// signatureOf returns the signature of the required parameters, which are given in pairs of name and type.
+func signatureOf(params ...string) *Signature {
+	signature := &Signature{}
+	for i := 0; i+1 < len(params); i += 2 {
+		signature.Params = append(signature.Params, Param{Name: params[i], Type: params[i+1]})
 	}
-	return selection.Find(expr)
+	return signature
 }
 
-func calleeXpath(node selector.Selection, args []string) (selection selector.Selection, err error) {
-	expr := args[0]
-
-	if selection, err = node.Type(selector.TypeXPATH); err != nil {
-		return
+// calleeSelector returns the function body of the processor which selects the elements of the selection type,
+// the selector is compiled when the arguments are bound or converted.
+func calleeSelector(typename string) TypedCallee {
+	return func(node selector.Selection, args Args) (selection selector.Selection, err error) {
+		if selection, err = node.Type(typename); err != nil {
+			return
+		}
+		return selector.FindQuery(selection, args[0].Query)
 	}
-	return selection.Find(expr)
 }
 
-func calleeRegex(node selector.Selection, args []string) (selection selector.Selection, err error) {
-	expr := args[0]
-
-	if selection, err = node.Type(selector.TypeREGEX); err != nil {
-		return
+func calleeTrim(node selector.Selection, args Args) (selection selector.Selection, err error) {
+	if cutset := args[0].String; cutset != "" {
+		return selector.NewString(strings.Trim(node.String(), cutset))
 	}
-	return selection.Find(expr)
-}
-
-func calleeTrim(node selector.Selection, args []string) (selection selector.Selection, err error) {
 	return selector.NewString(strings.TrimSpace(node.String()))
 }
 
-func calleeTemplate(node selector.Selection, args []string) (selection selector.Selection, err error) {
-	reference := args[0]
+func calleeTemplate(node selector.Selection, args Args) (selection selector.Selection, err error) {
+	reference := args[0].String
 	return selector.NewString(reference)
 }
 
-func calleeEq(node selector.Selection, args []string) (selection selector.Selection, err error) {
-	eq, err := strconv.Atoi(args[0])
-
-	if err != nil {
-		return nil, err
-	}
-
-	return node.Eq(eq)
+func calleeEq(node selector.Selection, args Args) (selection selector.Selection, err error) {
+	return node.Eq(args[0].Int)
 }
 
-func calleeString(node selector.Selection, args []string) (selection selector.Selection, err error) {
+func calleeString(node selector.Selection, args Args) (selection selector.Selection, err error) {
 	return selector.NewString(node.String())
 }
 
-func calleeText(node selector.Selection, args []string) (selection selector.Selection, err error) {
+func calleeText(node selector.Selection, args Args) (selection selector.Selection, err error) {
 	return selector.NewString(node.Text())
 }
 
-func calleeAttr(node selector.Selection, args []string) (selection selector.Selection, err error) {
-	attr := args[0]
+func calleeAttr(node selector.Selection, args Args) (selection selector.Selection, err error) {
+	attr := args[0].String
 
 	conseq, err := node.Attr(attr)
 	if err != nil {
@@ -113,19 +99,19 @@ func calleeAttr(node selector.Selection, args []string) (selection selector.Sele
 
 }
 
-func calleeLink(node selector.Selection, args []string) (selection selector.Selection, err error) {
-	reference := args[0]
+func calleeLink(node selector.Selection, args Args) (selection selector.Selection, err error) {
+	reference := args[0].String
 	return selector.NewString(reference)
 }
 
-func calleeReplace(node selector.Selection, args []string) (selection selector.Selection, err error) {
-	old, replace := args[0], args[1]
-	conseq := strings.Replace(node.String(), old, replace, -1)
+func calleeReplace(node selector.Selection, args Args) (selection selector.Selection, err error) {
+	old, replace, n := args[0].String, args[1].String, args[2].Int
+	conseq := strings.Replace(node.String(), old, replace, n)
 	return selector.NewString(conseq)
 }
 
-func calleeAbsolute(node selector.Selection, args []string) (selection selector.Selection, err error) {
-	raw, parent := node.String(), args[0]
+func calleeAbsolute(node selector.Selection, args Args) (selection selector.Selection, err error) {
+	raw, parent := node.String(), args[0].String
 	var parentURL, rawURL *url.URL
 	if parentURL, err = url.Parse(parent); err == nil {
 		if rawURL, err = url.Parse(raw); err == nil {
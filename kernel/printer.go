@@ -0,0 +1,332 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/storyicon/graphquery/kernel/pipeline"
+)
+
+// indent is the indentation of each nesting level in the printed expression.
+const indent = "    "
+
+// printer prints a Graph as an expression in the canonical layout.
+type printer struct {
+	strings.Builder
+	depth int
+}
+
+// String prints the graph as an expression in the canonical layout,
+// the comments kept in the graph are printed around the nodes they belong to.
+// Compiling the printed expression gives an equivalent graph.
+func (graph *Graph) String() string {
+	p := &printer{}
+	root := graph.Root
+	if root == nil {
+		root = &GraphNode{Name: TypeRootNode}
+	}
+	for _, imported := range graph.Imports {
+		p.WriteString("import " + quote(imported.Path))
+		if imported.Alias != "" {
+			p.WriteString(" as " + printName(imported.Alias))
+		}
+		p.WriteString("\n")
+	}
+	for _, fragment := range graph.Fragments {
+		p.separate()
+		p.comments(fragment, CommentLeading)
+		p.WriteString("fragment " + printName(fragment.Name) + " {")
+		p.children(fragment, fragment.Children)
+		p.WriteString("}")
+		p.trailing(fragment)
+		p.WriteString("\n")
+	}
+	// the empty body of an expression of imports and fragments only is left out
+	if len(graph.Nodes) > 0 || graph.GraphType != TypeObjectGraph || len(graph.Imports)+len(graph.Fragments) == 0 ||
+		hasComments(root, CommentLeading) || hasComments(root, CommentClosing) {
+		p.separate()
+		p.comments(root, CommentLeading)
+		switch graph.GraphType {
+		case TypeObjectGraph:
+			p.WriteString("{")
+			p.children(root, graph.Nodes)
+			p.WriteString("}")
+		default:
+			for _, node := range graph.Nodes {
+				p.node(node)
+			}
+		}
+		p.WriteString("\n")
+	}
+	// the comments at the end of the expression are printed on their own lines
+	for _, comment := range root.Comments {
+		if comment.Position == CommentTrailing {
+			p.WriteString(comment.Text + "\n")
+		}
+	}
+	return p.String()
+}
+
+// separate separates the sections of the expression with a blank line.
+func (p *printer) separate() {
+	if p.Len() > 0 {
+		p.WriteString("\n")
+	}
+}
+
+// node prints the node with its comments, the printer is at the beginning of a line.
+func (p *printer) node(node *GraphNode) {
+	p.comments(node, CommentLeading)
+	p.WriteString(printName(node.Name))
+	if IsLeafType(node.NodeType) && node.NodeType != TypeString {
+		p.WriteString(":" + LeafTypeName(node.NodeType))
+	}
+	if node.Required {
+		p.WriteString("!")
+	}
+	if node.Alias != "" {
+		p.WriteString(" as " + printName(node.Alias))
+	}
+	p.WriteString(" `" + printPipelines(node.Pipelines) + "`")
+	if node.Default != nil {
+		p.WriteString(" ?? " + printDefault(node))
+	}
+	switch node.NodeType {
+	case TypeObject:
+		p.WriteString(" {")
+		p.children(node, node.Children)
+		p.WriteString("}")
+	case TypeArray:
+		p.WriteString(" [")
+		p.children(node, node.Children)
+		p.WriteString("]")
+	case TypeObjectArray:
+		p.WriteString(" [{")
+		p.children(node, node.Children)
+		p.WriteString("}]")
+	}
+	if node.Filter != nil {
+		p.WriteString(" where (" + printPredicate(node.Filter, 0) + ")")
+	}
+	if node.List != nil {
+		p.WriteString(printList(node.List))
+	}
+	p.trailing(node)
+}
+
+// children prints the children and the closing comments of node between its brackets,
+// the children spread from a fragment are printed as the spread of it.
+func (p *printer) children(node *GraphNode, children []*GraphNode) {
+	if len(children) == 0 && !hasComments(node, CommentClosing) {
+		return
+	}
+	p.depth++
+	for i, child := range children {
+		if child.Fragment != "" && i > 0 && children[i-1].Fragment == child.Fragment {
+			continue
+		}
+		p.newline()
+		if child.Fragment != "" {
+			p.WriteString("..." + printName(child.Fragment))
+			continue
+		}
+		p.node(child)
+	}
+	for _, comment := range node.Comments {
+		if comment.Position == CommentClosing {
+			p.newline()
+			p.WriteString(comment.Text)
+		}
+	}
+	p.depth--
+	p.newline()
+}
+
+// comments prints the comments of node at the position, each of them on its own line.
+func (p *printer) comments(node *GraphNode, position int) {
+	for _, comment := range node.Comments {
+		if comment.Position == position {
+			p.WriteString(comment.Text)
+			p.newline()
+		}
+	}
+}
+
+// trailing prints the trailing comments of node on the same line.
+// A line comment ends the line, so the comments after it are moved to the next lines.
+func (p *printer) trailing(node *GraphNode) {
+	ended := false
+	for _, comment := range node.Comments {
+		if comment.Position != CommentTrailing {
+			continue
+		}
+		if ended {
+			p.newline()
+		} else {
+			p.WriteString(" ")
+		}
+		p.WriteString(comment.Text)
+		ended = strings.HasPrefix(comment.Text, "//")
+	}
+}
+
+// newline starts a new line at the current depth.
+func (p *printer) newline() {
+	p.WriteString("\n" + strings.Repeat(indent, p.depth))
+}
+
+// hasComments reports whether node has comments at the position.
+func hasComments(node *GraphNode, position int) bool {
+	for _, comment := range node.Comments {
+		if comment.Position == position {
+			return true
+		}
+	}
+	return false
+}
+
+// printPipelines prints the pipelines as they are written between backticks,
+// the sub-pipelines in the arguments are printed in the same way.
+func printPipelines(pipelines pipeline.Pipelines) string {
+	var conseq []string
+	for _, pipe := range pipelines {
+		args := make([]string, len(pipe.Args))
+		for i, arg := range pipe.Args {
+			if i < len(pipe.Exprs) && pipe.Exprs[i] != nil {
+				args[i] = printPipelines(pipe.Exprs[i])
+				continue
+			}
+			args[i] = quote(arg)
+		}
+		conseq = append(conseq, pipe.Name+"("+strings.Join(args, ", ")+")")
+	}
+	return strings.Join(conseq, ";")
+}
+
+// printPredicate prints the predicate of a filter,
+// it is parenthesized when it does not bind tighter than the operator outside it.
+func printPredicate(predicate *Predicate, outer int) string {
+	var conseq string
+	precedence := precedenceOf(predicate.Op)
+	switch op := predicate.Op; {
+	case op == OpAnd || op == OpOr:
+		operands := make([]string, len(predicate.Operands))
+		for i, operand := range predicate.Operands {
+			operands[i] = printPredicate(operand, precedence)
+		}
+		conseq = strings.Join(operands, " "+op+" ")
+	case op == OpNot:
+		// the negated comparison is parenthesized to be read easily
+		conseq = op + printPredicate(predicate.Operands[0], precedenceOf(">"))
+	case op == OperandString:
+		conseq = quote(predicate.Value)
+	case op == OperandNull:
+		conseq = "null"
+	case IsOperand(op):
+		conseq = predicate.Value
+	default:
+		conseq = printPredicate(predicate.Operands[0], precedence) + " " + op + " " + printPredicate(predicate.Operands[1], precedence)
+	}
+	if precedence <= outer {
+		return "(" + conseq + ")"
+	}
+	return conseq
+}
+
+// printList prints the list operators in the order they are applied.
+func printList(list *ListOperators) string {
+	var conseq []string
+	if list.Unique {
+		conseq = append(conseq, "unique")
+		if list.UniqueBy != "" {
+			conseq = append(conseq, "by", printName(list.UniqueBy))
+		}
+	}
+	if list.Sort {
+		conseq = append(conseq, "sort")
+		if list.SortBy != "" {
+			conseq = append(conseq, "by", printName(list.SortBy))
+		}
+		if list.SortMode != "" && list.SortMode != SortString {
+			conseq = append(conseq, list.SortMode)
+		}
+		if list.Descending {
+			conseq = append(conseq, "desc")
+		}
+	}
+	if list.Reverse {
+		conseq = append(conseq, "reverse")
+	}
+	if list.Offset > 0 {
+		conseq = append(conseq, "offset", strconv.Itoa(list.Offset))
+	}
+	if list.Limit > 0 {
+		conseq = append(conseq, "limit", strconv.Itoa(list.Limit))
+	}
+	return " " + strings.Join(conseq, " ")
+}
+
+// precedenceOf returns the precedence of the operator, the operands bind the tightest.
+func precedenceOf(op string) int {
+	switch {
+	case op == OpOr:
+		return 1
+	case op == OpAnd:
+		return 2
+	case op == OpNot:
+		return 3
+	case IsComparison(op):
+		return 4
+	}
+	return 5
+}
+
+// printDefault prints the default value of node,
+// it is quoted unless it is null or a literal of the type of a leaf node, such as 1.5 or true.
+func printDefault(node *GraphNode) string {
+	value := node.Default.Value
+	switch {
+	case node.Default.Null:
+		return "null"
+	case node.NodeType == TypeString || value == "" || value == "null":
+		return quote(value)
+	}
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_.+-", c)) {
+			return quote(value)
+		}
+	}
+	return value
+}
+
+// printName prints the name of node, it is quoted when it is not an identifier.
+func printName(name string) string {
+	if name == "" {
+		return quote(name)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return quote(name)
+		}
+	}
+	return name
+}
+
+// quote quotes the string in the way the compiler reads it.
+func quote(str string) string {
+	return `"` + strings.Replace(str, `"`, `\"`, -1) + `"`
+}
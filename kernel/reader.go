@@ -0,0 +1,135 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/storyicon/graphquery/kernel/pipeline"
+	"github.com/storyicon/graphquery/kernel/selector"
+)
+
+const (
+	// ErrReadDocument means the document can not be read or parsed from the reader
+	ErrReadDocument = "read document failed: %s"
+)
+
+// ParseReader is like Parse, but reads the document from reader only once.
+// When the first pipelines of the user nodes select the same type of elements, such as css() or json(),
+// the document is parsed into that type once, instead of being parsed again by each of the nodes.
+// CSS and XPATH documents are parsed while they are read, a JSON document is read into a string in full first.
+// Otherwise it is read into a string as Parse takes it.
+func (graph *Graph) ParseReader(reader io.Reader, options ...Option) *GraphResponse {
+	return graph.ParseReaderContext(context.Background(), reader, options...)
+}
+
+// ParseReaderContext is like ParseReader, but stops reading and parsing when ctx is cancelled or expired.
+func (graph *Graph) ParseReaderContext(ctx context.Context, reader io.Reader, options ...Option) *GraphResponse {
+	if ctx.Done() != nil {
+		reader = &contextReader{ctx: ctx, reader: reader}
+	}
+	typename := graph.rootType()
+	if isDocumentType(typename) {
+		// the CSS selection of the document converts to the XPATH selection of its document node,
+		// so both of them select the same nodes as they do from the string of the document
+		typename = selector.TypeCSS
+	}
+	selection, err := selector.NewSelectionReader(typename, reader)
+	if err != nil {
+		return &GraphResponse{
+			Errors: Errors{{Err: fmt.Sprintf(ErrReadDocument, err)}},
+		}
+	}
+	return graph.parseSelection(ctx, selection, options...)
+}
+
+// rootType returns the selection type which the document read by ParseReader is parsed into,
+// it is the type selected by the first pipelines of all the user nodes and of the sub-pipelines of root().
+// CSS and XPATH are taken as one type, since their selections share the parsed document.
+// It is selector.TypeSTRING when they differ, or any of them does not select elements.
+func (graph *Graph) rootType() string {
+	registry := graph.registry()
+	conseq := ""
+	// same reports whether the pipelines select the elements of the type found so far
+	same := func(pipelines pipeline.Pipelines) bool {
+		if len(pipelines) == 0 {
+			return false
+		}
+		proc := registry.Lookup(pipelines[0].Name)
+		if proc == nil || proc.Selection == "" {
+			return false
+		}
+		switch typename := proc.Selection; {
+		case conseq == "" || typename == conseq:
+			conseq = typename
+		case isDocumentType(typename) && isDocumentType(conseq):
+		default:
+			return false
+		}
+		return true
+	}
+	var roots func(pipelines pipeline.Pipelines) bool
+	roots = func(pipelines pipeline.Pipelines) bool {
+		for _, pipe := range pipelines {
+			if pipe.Name == pipeline.RootFunc && (len(pipe.Exprs) == 0 || !same(pipe.Exprs[0])) {
+				return false
+			}
+			for _, expr := range pipe.Exprs {
+				if !roots(expr) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	var walk func(nodes []*GraphNode) bool
+	walk = func(nodes []*GraphNode) bool {
+		for _, node := range nodes {
+			if !roots(node.Pipelines) || !walk(node.Children) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, node := range graph.Nodes {
+		if !same(node.Pipelines) {
+			return selector.TypeSTRING
+		}
+	}
+	if conseq == "" || !walk(graph.Nodes) {
+		return selector.TypeSTRING
+	}
+	return conseq
+}
+
+// isDocumentType reports whether the selections of the type are made of the nodes of a parsed HTML document.
+func isDocumentType(typename string) bool {
+	return typename == selector.TypeCSS || typename == selector.TypeXPATH
+}
+
+// contextReader stops reading when its context is cancelled or expired.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (reader *contextReader) Read(p []byte) (int, error) {
+	if err := reader.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return reader.reader.Read(p)
+}
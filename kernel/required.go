@@ -0,0 +1,80 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+)
+
+const (
+	// ErrRequired means a required node is missing in the document
+	ErrRequired = "required node %q is %s"
+)
+
+const (
+	// ReasonEmpty means the required node resolves to empty
+	ReasonEmpty = "empty"
+	// ReasonFailed means the pipelines of the required node return an error
+	// or its value can not be converted
+	ReasonFailed = "failed"
+)
+
+// ValidationError is the error of a required node which is missing in the document,
+// it is the Detail of the Error recorded in GraphResponse.Errors.
+type ValidationError struct {
+	// Path is the path of the node in the output, such as "items[1].title".
+	Path string
+	// Reason is ReasonEmpty or ReasonFailed.
+	Reason string
+}
+
+var _ error = &ValidationError{}
+
+// Error implements the error interface.
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf(ErrRequired, err.Path, err.Reason)
+}
+
+// WithStrict makes the parse return nil Data when any required node is missing,
+// the ValidationErrors are still recorded in GraphResponse.Errors.
+func WithStrict() Option {
+	return func(exec *execution) {
+		exec.strict = true
+	}
+}
+
+// checkRequired records a ValidationError when the scope of a required node is missing,
+// empty reports whether the node is empty and invalid reports whether its value can not be converted.
+func (s *scope) checkRequired(empty bool, invalid bool) {
+	if !s.node.Required {
+		return
+	}
+	reason := ReasonEmpty
+	switch {
+	case s.failed || invalid:
+		reason = ReasonFailed
+	case !empty:
+		return
+	}
+	err := &ValidationError{
+		Path:   s.path(),
+		Reason: reason,
+	}
+	s.exec.missing = true
+	s.exec.errors = append(s.exec.errors, &Error{
+		Err:    err.Error(),
+		Detail: err,
+	})
+}
@@ -0,0 +1,427 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/storyicon/graphquery/kernel/pipeline"
+	"github.com/storyicon/graphquery/kernel/selector"
+)
+
+// scope is a GraphNode evaluated under a specific parent selection.
+// Every element of an array node gets its own scope, so the selections
+// cached in the scopes of its children never leak into the next element.
+type scope struct {
+	exec   *execution
+	node   *GraphNode
+	parent *scope
+
+	selection selector.Selection
+	resolved  bool
+	// failed reports whether the pipelines of the scope returned an error,
+	// partial reports whether they were stopped by the execution before they completed.
+	failed   bool
+	partial  bool
+	children map[*GraphNode]*scope
+	// index is the index of the element when indexed is true,
+	// which means the scope is an element of an array node.
+	index   int
+	indexed bool
+}
+
+// child returns the scope of a child node of the current scope,
+// it is created when it is first used.
+func (s *scope) child(node *GraphNode) *scope {
+	if s.children == nil {
+		s.children = map[*GraphNode]*scope{}
+	}
+	if conseq, exists := s.children[node]; exists {
+		return conseq
+	}
+	conseq := &scope{
+		exec:   s.exec,
+		node:   node,
+		parent: s,
+	}
+	s.children[node] = conseq
+	return conseq
+}
+
+// element returns the scope of the node with the element at index as its selection.
+func (s *scope) element(index int, selection selector.Selection) *scope {
+	return &scope{
+		exec:      s.exec,
+		node:      s.node,
+		parent:    s.parent,
+		selection: selection,
+		resolved:  true,
+		index:     index,
+		indexed:   true,
+	}
+}
+
+// parse recursively resolves all nodes,
+// it returns nil when the execution is stopped before the value of node is complete,
+// the values completed before the execution is stopped are kept,
+// and the containers stopped halfway keep the values parsed so far.
+func (s *scope) parse() *GraphData {
+	node := s.node
+	if s.exec.interrupted() || !s.exec.countValue() {
+		return nil
+	}
+	conseq := NewGraphData(node.Key(), node.NodeType)
+	selection := s.getSelection()
+	if s.partial {
+		return nil
+	}
+
+	if IsLeafType(node.NodeType) {
+		// the value of a leaf node without selection is empty
+		value := s.String()
+		if s.exec.truncated {
+			return nil
+		}
+		err := conseq.Value(value)
+		if err != nil {
+			s.addError(err)
+		}
+		empty := strings.TrimSpace(value) == ""
+		if s.useDefault(empty, err != nil) {
+			return s.defaultData()
+		}
+		s.checkRequired(empty, err != nil)
+		return conseq
+	}
+
+	if selection != nil {
+		switch node.NodeType {
+		case TypeArray, TypeObjectArray:
+			s.parseElements(conseq, selection)
+		case TypeObject:
+			node.each(func(j int, child *GraphNode) bool {
+				value := s.child(child).parse()
+				if value == nil {
+					return false
+				}
+				if err := conseq.Set(child.Key(), value); err != nil {
+					s.addError(err)
+					return false
+				}
+				return true
+			})
+		default:
+			s.addError(fmt.Sprintf(ErrWrongTypeCall,
+				"parse", "graph node", node.NodeType,
+			))
+		}
+	}
+	if s.exec.interrupted() {
+		return conseq
+	}
+	empty := isEmpty(selection)
+	if s.useDefault(empty, false) {
+		return s.defaultData()
+	}
+	s.checkRequired(empty, false)
+	return conseq
+}
+
+// parseElements parses the elements of the selection of an array node into conseq,
+// they are filtered and arranged by the filter and the list operators of the node.
+func (s *scope) parseElements(conseq *GraphData, selection selector.Selection) {
+	node, list := s.node, s.node.List
+	var (
+		kept, skipped int
+		seen          = map[string]bool{}
+		collected     [][]*GraphData
+		records       []*elementRecord
+	)
+	push := func(index int, values []*GraphData) bool {
+		if s.exec.streams(node) {
+			return s.emit(values)
+		}
+		for j, value := range values {
+			if err := conseq.Push(index, node.Children[j].Key(), value); err != nil {
+				s.addError(err)
+				return false
+			}
+		}
+		return true
+	}
+	selection.Each(func(i int, element selector.Selection) bool {
+		if s.exec.interrupted() || !s.exec.checkElement(node, i) {
+			return false
+		}
+		// the element is indexed by its position in the output, the dropped ones take no index
+		context := s.element(kept, element)
+		mark := s.exec.mark()
+		values := context.values()
+		if len(values) < len(node.Children) {
+			// the element stopped halfway can not be matched, arranged or emitted, it is left out
+			if node.Filter == nil && list == nil && !s.exec.streams(node) {
+				push(kept, values)
+			}
+			return false
+		}
+		// the dropped elements leave no defaults or validation errors
+		if node.Filter != nil && !context.match(node.Filter, named(node.Children, values)) {
+			s.exec.rollback(mark)
+			return true
+		}
+		if list != nil && list.Unique {
+			key := list.uniqueKey(node.Children, values)
+			if seen[key] {
+				s.exec.rollback(mark)
+				return true
+			}
+			seen[key] = true
+		}
+		switch {
+		case list != nil && list.ordered():
+			// the records are kept aside until the element takes its position in the output
+			collected = append(collected, values)
+			records = append(records, s.exec.takeRecords(mark, context.path()))
+			kept++
+			return true
+		case list != nil && skipped < list.Offset:
+			skipped++
+			s.exec.rollback(mark)
+			return true
+		}
+		if !push(kept, values) {
+			return false
+		}
+		kept++
+		// the rest of the elements are not parsed once the limit is reached
+		return list == nil || list.Limit <= 0 || kept < list.Limit
+	})
+	if list == nil || !list.ordered() {
+		return
+	}
+	indexes := list.arrange(node.Children, collected)
+	output := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		output[i] = true
+	}
+	// the dropped elements leave no defaults or validation errors
+	for i, record := range records {
+		if !output[i] {
+			s.exec.restoreRecords(record, "", false)
+		}
+	}
+	for index, i := range indexes {
+		s.exec.restoreRecords(records[i], s.element(index, nil).path(), true)
+		if !push(index, collected[i]) {
+			return
+		}
+	}
+}
+
+// values parses the children of the scope in turn,
+// it stops at the first child whose value is nil because the execution is stopped.
+func (s *scope) values() (values []*GraphData) {
+	s.node.each(func(j int, child *GraphNode) bool {
+		value := s.child(child).parse()
+		if value == nil {
+			return false
+		}
+		values = append(values, value)
+		return true
+	})
+	return
+}
+
+// named returns the values of the children by their names.
+func named(children []*GraphNode, values []*GraphData) map[string]*GraphData {
+	conseq := map[string]*GraphData{}
+	for j, value := range values {
+		conseq[children[j].Name] = value
+	}
+	return conseq
+}
+
+func (s *scope) addError(err interface{}) {
+	s.exec.addNodeError(s.node, err)
+}
+
+// getSelection is used to get the selection of the current scope
+// from cache or to calculate selection by pipeline.
+func (s *scope) getSelection() selector.Selection {
+	//When the selection is already resolved, it returns directly.
+	//the selection of the root scope and element scopes is resolved when they are created.
+	if s.resolved || s.parent == nil {
+		return s.selection
+	}
+	//calculate the selection of the current node through pipeline
+	parent, pipelines := s.parent.getSelection(), s.getPipelines()
+	if s.parent.partial || !s.exec.countCalls(pipelines.Calls()) {
+		s.resolved, s.partial = true, true
+		return nil
+	}
+	conseq, err := s.exec.registry().ProcessContext(s.exec.ctx, parent, pipelines)
+	// the interruption is reported by the execution, not by every node
+	switch {
+	case err != nil && s.exec.interrupted():
+		s.partial = true
+	case err != nil:
+		s.addError(err)
+		s.failed = true
+	}
+	s.selection, s.resolved = s.exec.limit(conseq), true
+
+	return conseq
+}
+
+// getPipelines is used to copy the pipelines of node and render it
+func (s *scope) getPipelines() pipeline.Pipelines {
+	return s.renderPipelines(s.node.Pipelines)
+}
+
+// renderPipelines copies the pipelines and renders their arguments,
+// including the ones of the sub-pipelines in the arguments.
+func (s *scope) renderPipelines(pipes pipeline.Pipelines) pipeline.Pipelines {
+	var pipelines pipeline.Pipelines
+	for _, pipe := range pipes {
+		var args []string
+		var exprs []pipeline.Pipelines
+
+		switch pipe.Name {
+		// link pipeline has some particularities,
+		// it can refer to variables directly instead of {$variable} in strings
+		case "link":
+			if err := s.exec.registry().Check(pipe); err != nil {
+				s.addError(err)
+				continue
+			}
+			reference := ""
+			varname := pipe.Args[0]
+			if varname == s.node.Name {
+				continue
+			}
+			if conseq := s.lookUp(varname); conseq != nil {
+				reference = conseq.String()
+			}
+			args = append(args, reference)
+
+		default:
+			// the arguments of a bound pipeline have no variable to render
+			if pipe.Bound() {
+				pipelines = append(pipelines, pipe)
+				continue
+			}
+			// other pipeline
+			for _, arg := range pipe.Args {
+				args = append(args, s.render(arg))
+			}
+			for _, expr := range pipe.Exprs {
+				exprs = append(exprs, s.renderPipelines(expr))
+			}
+		}
+
+		// A copy of a variable rendered pipeline.
+		pipelines = append(pipelines, &pipeline.Pipeline{
+			Name:  pipe.Name,
+			Args:  args,
+			Exprs: exprs,
+		})
+	}
+	return pipelines
+}
+
+// render replaces the variables in the passed string with their values,
+// the variables which can not be found are left as they are.
+func (s *scope) render(str string) string {
+	segments := s.exec.graph.template(str)
+	if segments == nil {
+		return str
+	}
+	var conseq strings.Builder
+	for _, segment := range segments {
+		if !segment.variable {
+			conseq.WriteString(segment.text)
+			continue
+		}
+		varname := segment.text
+		//reference self
+		if varname == "" || varname == s.node.Name {
+			//it will change dynamically, throw it to pipeline.
+			conseq.WriteString(pipeline.InvokePlaceholder)
+		} else if variable := s.lookUp(varname); variable != nil {
+			// referenced to other variables
+			conseq.WriteString(variable.String())
+		} else {
+			// failed to find the variable described
+			conseq.WriteString("{$" + varname + "}")
+		}
+	}
+	return conseq.String()
+}
+
+// lookUp searches for the node from the previous sibling node and all parent nodes.
+func (s *scope) lookUp(name string) (conseq *scope) {
+	if conseq = s.prev(name); conseq == nil {
+		conseq = s.parents(name)
+	}
+	return
+}
+
+// parents is used to locate nodes from parent,
+// including the siblings of parent and ancestor.
+func (s *scope) parents(name string) *scope {
+	if parent := s.parent; parent != nil {
+		if siblings := parent.siblings(name); siblings != nil {
+			return siblings
+		}
+		return parent.parents(name)
+	}
+	return nil
+}
+
+// siblings is used to find brotherhood nodes.
+func (s *scope) siblings(name string) *scope {
+	if parent := s.parent; parent != nil {
+		for _, child := range parent.node.Children {
+			if child.Name == name {
+				return parent.child(child)
+			}
+		}
+	}
+	return nil
+}
+
+// prev is used to find the sibling nodes before the current node.
+func (s *scope) prev(name string) *scope {
+	if parent := s.parent; parent != nil {
+		for _, child := range parent.node.Children {
+			switch child.Name {
+			case name:
+				return parent.child(child)
+			case s.node.Name: // if traverse the current node, return nil directly.
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// String method of the scope returns the Text of selection.
+func (s *scope) String() string {
+	if selection := s.getSelection(); selection != nil {
+		return selection.Text()
+	}
+	return ""
+}
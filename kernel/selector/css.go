@@ -16,25 +16,45 @@ package selector
 
 import (
 	"errors"
+	"io"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
 )
 
 // CSSSelection is an element set maintained by the CSS parser.
 type CSSSelection struct {
 	// Nodes stores the current element collection.
 	Nodes *goquery.Selection
+	// document is the document node of the parsed document whose contents are Nodes,
+	// the XPATH selection converted from the selection starts from it, as the one of NewXpath does.
+	document *html.Node
+	// view is the document of the nodes of the XPATH selection converted to the selection,
+	// the selection stands for the html element of the document instead of Nodes when it is not nil.
+	view *view
+	// within is the view which the nodes are selected from, the selectors applied to them match its document.
+	within *view
 }
 
 // NewCSS is used to initialize a CSS Selection from the string
 // It's a constructor function.
 func NewCSS(document string) (Selection, error) {
-	node, err := goquery.NewDocumentFromReader(strings.NewReader(document))
+	return NewCSSReader(strings.NewReader(document))
+}
+
+// NewCSSReader is like NewCSS, but parses the document while reading it from reader.
+func NewCSSReader(reader io.Reader) (Selection, error) {
+	node, err := goquery.NewDocumentFromReader(reader)
 	if err == nil {
-		return &CSSSelection{
+		conseq := &CSSSelection{
 			Nodes: node.Contents(),
-		}, nil
+		}
+		if len(node.Nodes) > 0 {
+			conseq.document = node.Nodes[0]
+		}
+		return conseq, nil
 	}
 	return nil, err
 }
@@ -44,6 +64,15 @@ func NewCSS(document string) (Selection, error) {
 // it returns the current element set when the selector is empty.
 // It's a standard method of the selection implementation
 func (selection *CSSSelection) Find(selector string) (Selection, error) {
+	if selection.view != nil {
+		if selector == "" {
+			return selection, nil
+		}
+		return selection.findView(selector, nil)
+	}
+	if selection.within != nil && selector != "" {
+		return selection.findWithin(selector, nil)
+	}
 	nodes := selection.Nodes
 	if selector != "" {
 		nodes = nodes.Find(selector)
@@ -53,11 +82,80 @@ func (selection *CSSSelection) Find(selector string) (Selection, error) {
 	}, nil
 }
 
+// FindQuery is like Find, but applies the compiled query.
+// It is a method of the QueryFinder implementation
+func (selection *CSSSelection) FindQuery(query *Query) (Selection, error) {
+	if query.Type != TypeCSS || query.css == nil {
+		return selection.Find(query.Expr)
+	}
+	if selection.view != nil {
+		return selection.findView(query.Expr, query.css)
+	}
+	if selection.within != nil {
+		return selection.findWithin(query.Expr, query.css)
+	}
+	return &CSSSelection{
+		Nodes: selection.Nodes.FindMatcher(query.css),
+	}, nil
+}
+
+// findView selects the elements matched by the selector from the document of the view,
+// the HTML of the nodes is parsed when the selector may depend on the elements out of the view.
+func (selection *CSSSelection) findView(selector string, matcher cascadia.Selector) (Selection, error) {
+	if nodes, ok := selection.view.selectCSS(selector, matcher); ok {
+		return &CSSSelection{
+			Nodes:  &goquery.Selection{Nodes: nodes},
+			within: selection.view,
+		}, nil
+	}
+	document, err := NewCSS(selection.view.html())
+	if err != nil {
+		return nil, err
+	}
+	return document.Find(selector)
+}
+
+// findWithin is like findView, but selects from the nodes selected from the view.
+func (selection *CSSSelection) findWithin(selector string, matcher cascadia.Selector) (Selection, error) {
+	if !isElementSelector(selector) {
+		parsed := selection.within.parsed(selection.Nodes.Nodes)
+		return (&CSSSelection{Nodes: &goquery.Selection{Nodes: parsed}}).Find(selector)
+	}
+	nodes := selection.Nodes
+	if matcher != nil {
+		nodes = nodes.FindMatcher(matcher)
+	} else {
+		nodes = nodes.Find(selector)
+	}
+	return &CSSSelection{
+		Nodes:  nodes,
+		within: selection.within,
+	}, nil
+}
+
 // Type method is used to convert the current Selection to other types.
+// The XPATH selection selects from the same nodes as it selects from the document parsed from their HTML,
+// the document is not parsed again unless its nodes would be moved by the parser, see view.
 // It's a standard method of the selection implementation
 func (selection *CSSSelection) Type(typename string) (Selection, error) {
-	if typename == TypeCSS {
+	switch typename {
+	case TypeCSS:
 		return selection, nil
+	case TypeXPATH:
+		if selection.document != nil {
+			return &XpathSelection{
+				Nodes: []*html.Node{selection.document},
+			}, nil
+		}
+		if selection.view != nil {
+			return &XpathSelection{view: selection.view}, nil
+		}
+		if selection.Nodes == nil {
+			break
+		}
+		if view := newView(selection.Nodes.Nodes); view != nil {
+			return &XpathSelection{view: view}, nil
+		}
 	}
 	return NewSelection(typename, selection.String())
 }
@@ -66,18 +164,31 @@ func (selection *CSSSelection) Type(typename string) (Selection, error) {
 // the index starts at 0
 // It's a standard method of the selection implementation
 func (selection *CSSSelection) Eq(index int) (Selection, error) {
+	if selection.view != nil {
+		// the html element is the only element of the selection
+		if index == 0 || index == -1 {
+			return selection, nil
+		}
+		return &CSSSelection{Nodes: &goquery.Selection{}}, nil
+	}
 	conseq := selection.Nodes.Eq(index)
 	return &CSSSelection{
-		Nodes: conseq,
+		Nodes:  conseq,
+		within: selection.within,
 	}, nil
 }
 
 // Each is used to traverse the current elements
 // It's a standard method of the selection implementation
 func (selection *CSSSelection) Each(iterator func(int, Selection) bool) error {
+	if selection.view != nil {
+		iterator(0, selection)
+		return nil
+	}
 	for i := 0; i < selection.Nodes.Length(); i++ {
 		if !iterator(i, &CSSSelection{
-			Nodes: selection.Nodes.Eq(i),
+			Nodes:  selection.Nodes.Eq(i),
+			within: selection.within,
 		}) {
 			break
 		}
@@ -91,6 +202,7 @@ func (selection *CSSSelection) Attr(attr string) (string, error) {
 	if attr == "" {
 		return "", errors.New("attr method requires a string type parameter")
 	}
+	// the html element of a view has no attributes
 	conseq, _ := selection.Nodes.Attr(attr)
 	return conseq, nil
 }
@@ -98,19 +210,30 @@ func (selection *CSSSelection) Attr(attr string) (string, error) {
 // String method is used to return the string of all elements in the current element collection
 // the html/xml tag in this text will not be deleted
 // It's a standard method of the selection implementation
-func (selection *CSSSelection) String() (document string) {
-	// if don't traverse here and use goquery. OuterHtml (selection. Nodes) directly,
-	// will get only OuterHtml of the first element
-	for i := 0; i < selection.Nodes.Length(); i++ {
-		block, _ := goquery.OuterHtml(selection.Nodes.Eq(i))
-		document += block
-	}
-	return
+func (selection *CSSSelection) String() string {
+	return output(selection.OutputString)
 }
 
 // Text method is used to return the text of all elements in the current element collection
 // the text will not contain html/xml tags and attributes
 // It's a standard method of the selection implementation
 func (selection *CSSSelection) Text() string {
-	return selection.Nodes.Text()
+	return output(selection.OutputText)
+}
+
+// OutputString writes the String of the selection to writer, see OutputWriter.
+func (selection *CSSSelection) OutputString(writer io.Writer) error {
+	if selection.view != nil {
+		return selection.view.outputString(writer)
+	}
+	// the outer HTML of all the elements is written, not only the one of the first element
+	return renderNodes(writer, selection.Nodes.Nodes)
+}
+
+// OutputText writes the Text of the selection to writer, see OutputWriter.
+func (selection *CSSSelection) OutputText(writer io.Writer) error {
+	if selection.view != nil {
+		return selection.view.outputText(writer)
+	}
+	return writeText(writer, selection.Nodes.Nodes)
 }
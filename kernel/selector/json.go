@@ -16,6 +16,7 @@ package selector
 
 import (
 	"errors"
+	"io"
 
 	"github.com/tidwall/gjson"
 )
@@ -35,6 +36,17 @@ func NewJSON(document string) (*JSONSelection, error) {
 	}, nil
 }
 
+// NewJSONReader is like NewJSON, but reads the document from reader.
+// The whole document is read into a string first, as the values are selected as raw parts of it,
+// so the values are the same as the ones of NewJSON.
+func NewJSONReader(reader io.Reader) (*JSONSelection, error) {
+	document, err := ReadString(reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSON(document)
+}
+
 // Find is used to find the set of elements
 // described by the selector in the current collection of elements
 // it returns the current element set when the selector is empty.
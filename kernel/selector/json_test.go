@@ -1,6 +1,7 @@
 package selector
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -39,3 +40,39 @@ func TestJSONSelection_Text(t *testing.T) {
 		}
 	}
 }
+
+func TestNewJSONReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		find     string
+	}{
+		{
+			name:     "test0",
+			document: "{\n    \"name\": \"graph query\",\n    \"tags\": [ \"a\", \"b\" ]\n}\n",
+			find:     "tags",
+		},
+		{
+			name:     "test1",
+			document: `{ "quote": "say \"hi\" ", "path": "c:\\ dir\\" , "n" : 1 }`,
+			find:     "quote",
+		},
+	}
+	for _, tt := range tests {
+		selection, err := NewJSONReader(strings.NewReader(tt.document))
+		if err != nil {
+			t.Errorf("%q. NewJSONReader() error = %v", tt.name, err)
+			continue
+		}
+		// the document is decoded as NewJSON decodes it
+		want, _ := NewJSON(tt.document)
+		if got := selection.String(); got != want.String() {
+			t.Errorf("%q. NewJSONReader() = %v, want %v", tt.name, got, want.String())
+		}
+		got, _ := selection.Find(tt.find)
+		wantFound, _ := want.Find(tt.find)
+		if got.String() != wantFound.String() {
+			t.Errorf("%q. NewJSONReader().Find() = %v, want %v", tt.name, got.String(), wantFound.String())
+		}
+	}
+}
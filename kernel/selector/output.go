@@ -0,0 +1,71 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package selector
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// OutputWriter is implemented by the selections which build their String and Text by writing them to a writer,
+// so that the building is stopped by the first error of the writer, such as the one bounding the size of the output.
+type OutputWriter interface {
+	// OutputString writes the String of the selection to writer
+	OutputString(writer io.Writer) error
+	// OutputText writes the Text of the selection to writer
+	OutputText(writer io.Writer) error
+}
+
+// renderNodes writes the HTML of the nodes to writer.
+func renderNodes(writer io.Writer, nodes []*html.Node) error {
+	for _, node := range nodes {
+		if err := html.Render(writer, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeText writes the text of the nodes to writer, the tags, the attributes and the comments are left out.
+func writeText(writer io.Writer, nodes []*html.Node) error {
+	var write func(node *html.Node) error
+	write = func(node *html.Node) error {
+		if node.Type == html.TextNode {
+			_, err := io.WriteString(writer, node.Data)
+			return err
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if err := write(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, node := range nodes {
+		if err := write(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// output returns what is written by write.
+func output(write func(writer io.Writer) error) string {
+	var builder strings.Builder
+	write(&builder)
+	return builder.String()
+}
@@ -0,0 +1,101 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package selector
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/xpath"
+)
+
+// Query is a selector compiled in advance for a selection type,
+// so that it is not parsed again for every element it is applied to.
+// It is safe to apply a Query from multiple goroutines.
+type Query struct {
+	// Type is the selection type of the selector, Expr is the selector itself.
+	Type string
+	Expr string
+	// the compiled forms of the selectors of the built-in types
+	css   cascadia.Selector
+	xpath *xpath.Expr
+	regex *regexp.Regexp
+}
+
+// QueryFinder is implemented by the selections which find the elements with a compiled Query,
+// the selections wrapping another selection implement it to forward the query to the wrapped one.
+type QueryFinder interface {
+	FindQuery(query *Query) (Selection, error)
+}
+
+// maxQueries is the max number of the queries cached.
+const maxQueries = 4096
+
+// queries caches the compiled queries by selection type and selector,
+// so that the graphs compiled from the same expression share them.
+var queries = struct {
+	sync.RWMutex
+	cache map[[2]string]*Query
+}{
+	cache: map[[2]string]*Query{},
+}
+
+// CompileQuery validates and compiles the selector of the selection type,
+// the selectors of the types which can not be compiled in advance, such as JSON, are kept as they are.
+// An empty selector selects the current elements, it is not compiled.
+func CompileQuery(typename string, expr string) (query *Query, err error) {
+	key := [2]string{typename, expr}
+	queries.RLock()
+	query, exists := queries.cache[key]
+	queries.RUnlock()
+	if exists {
+		return query, nil
+	}
+	query = &Query{
+		Type: typename,
+		Expr: expr,
+	}
+	if expr != "" || typename == TypeREGEX {
+		switch typename {
+		case TypeCSS:
+			query.css, err = cascadia.Compile(expr)
+		case TypeXPATH:
+			query.xpath, err = xpath.Compile(expr)
+		case TypeREGEX:
+			query.regex, err = regexp.Compile(expr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	queries.Lock()
+	defer queries.Unlock()
+	if cached, exists := queries.cache[key]; exists {
+		return cached, nil
+	}
+	if len(queries.cache) < maxQueries {
+		queries.cache[key] = query
+	}
+	return query, nil
+}
+
+// FindQuery is like selection.Find(query.Expr), but the compiled query is used when the selection supports it.
+func FindQuery(selection Selection, query *Query) (Selection, error) {
+	if finder, ok := selection.(QueryFinder); ok {
+		return finder.FindQuery(query)
+	}
+	return selection.Find(query.Expr)
+}
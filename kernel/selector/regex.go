@@ -27,11 +27,25 @@ func NewRegex(document string) (*RegexSelection, error) {
 // it returns the current element set when the selector is empty.
 // It's a standard method of the selection implementation
 func (selection *RegexSelection) Find(selector string) (Selection, error) {
-	nodes := selection.Nodes
 	regex, err := regexp.Compile(selector)
 	if err != nil {
 		return selection, fmt.Errorf("Unable to resolve regular expression: %s", selector)
 	}
+	return selection.findRegexp(regex), nil
+}
+
+// FindQuery is like Find, but applies the compiled query.
+// It is a method of the QueryFinder implementation
+func (selection *RegexSelection) FindQuery(query *Query) (Selection, error) {
+	if query.Type != TypeREGEX || query.regex == nil {
+		return selection.Find(query.Expr)
+	}
+	return selection.findRegexp(query.regex), nil
+}
+
+// findRegexp finds the submatches of regex, or the matches when it has no group.
+func (selection *RegexSelection) findRegexp(regex *regexp.Regexp) Selection {
+	nodes := selection.Nodes
 	var conseq []string
 	for _, node := range nodes {
 		matches := regex.FindAllStringSubmatch(node, -1)
@@ -45,7 +59,7 @@ func (selection *RegexSelection) Find(selector string) (Selection, error) {
 	}
 	return &RegexSelection{
 		Nodes: conseq,
-	}, nil
+	}
 }
 
 // Type method is used to convert the current Selection to other types.
@@ -14,7 +14,12 @@
 
 package selector
 
-import "errors"
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
 
 const (
 	// TypeJSON identifies the currently selected type as JSON
@@ -58,17 +63,113 @@ type Selection interface {
 	String() string
 }
 
+// Factory creates a Selection of a type from the document,
+// the Type method of the Selection converts it to the other types with NewSelection.
+type Factory func(document string) (Selection, error)
+
+const (
+	// ErrUndefinedType means no factory is registered with the selection type
+	ErrUndefinedType = "undefined selection type: %s"
+	// ErrTypeExists means a factory is already registered with the selection type
+	ErrTypeExists = "selection regist failed: %s already exists"
+)
+
+// factories are the registered factories by selection type.
+var factories = struct {
+	sync.RWMutex
+	types map[string]Factory
+}{
+	types: map[string]Factory{
+		TypeCSS: NewCSS,
+		TypeJSON: func(document string) (Selection, error) {
+			return selectionOf(NewJSON(document))
+		},
+		TypeREGEX: func(document string) (Selection, error) {
+			return selectionOf(NewRegex(document))
+		},
+		TypeXPATH: func(document string) (Selection, error) {
+			return selectionOf(NewXpath(document))
+		},
+	},
+}
+
+// selectionOf returns a nil Selection instead of a typed nil when err is not nil.
+func selectionOf(selection Selection, err error) (Selection, error) {
+	if err != nil {
+		return nil, err
+	}
+	return selection, nil
+}
+
+// RegistSelection is used to register the factory of a selection type,
+// so that the selections of the other types can be converted to it by their Type method.
+// It fails when a factory is already registered with the type.
+func RegistSelection(typename string, factory Factory) error {
+	factories.Lock()
+	defer factories.Unlock()
+	if _, exists := factories.types[typename]; exists {
+		return fmt.Errorf(ErrTypeExists, typename)
+	}
+	factories.types[typename] = factory
+	return nil
+}
+
+// IsType reports whether a factory is registered with the selection type.
+func IsType(typename string) bool {
+	factories.RLock()
+	defer factories.RUnlock()
+	_, exists := factories.types[typename]
+	return exists
+}
+
 // NewSelection is used to initialize the selector of the specified type from the string.
 func NewSelection(typename string, document string) (Selection, error) {
+	factories.RLock()
+	factory, exists := factories.types[typename]
+	factories.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf(ErrUndefinedType, typename)
+	}
+	return factory(document)
+}
+
+// NewSelectionReader is like NewSelection, but reads the document from reader.
+// The CSS and XPATH documents are parsed while they are read, instead of being copied into a string first,
+// a JSON document is read into a string in full, see NewJSONReader.
+func NewSelectionReader(typename string, reader io.Reader) (Selection, error) {
 	switch typename {
 	case TypeCSS:
-		return NewCSS(document)
-	case TypeJSON:
-		return NewJSON(document)
-	case TypeREGEX:
-		return NewRegex(document)
+		return NewCSSReader(reader)
 	case TypeXPATH:
-		return NewXpath(document)
+		return selectionOf(NewXpathReader(reader))
+	case TypeJSON:
+		return selectionOf(NewJSONReader(reader))
+	}
+	document, err := ReadString(reader)
+	if err != nil {
+		return nil, err
+	}
+	if typename == TypeSTRING {
+		return NewString(document)
+	}
+	return NewSelection(typename, document)
+}
+
+// ReadString reads the document from reader into a string,
+// the bytes read are not copied again when they are converted to the string.
+func ReadString(reader io.Reader) (string, error) {
+	var builder strings.Builder
+	growFor(&builder, reader)
+	if _, err := io.Copy(&builder, reader); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+// growFor grows the builder to the length of the unread part of reader when it is known,
+// such as the one of a bytes.Reader or a strings.Reader.
+func growFor(builder *strings.Builder, reader io.Reader) {
+	if sized, ok := reader.(interface{ Len() int }); ok {
+		builder.Grow(sized.Len())
 	}
-	return nil, errors.New("undefined selection type")
 }
@@ -58,7 +58,16 @@ func TestNewSelection(t *testing.T) {
 		want    Selection
 		wantErr bool
 	}{
-	// TODO: Add test cases.
+		{
+			name:    "test0",
+			args:    args{typename: "PROTO", document: "name: \"a\""},
+			wantErr: true,
+		},
+		{
+			name: "test1",
+			args: args{typename: TypeREGEX, document: "a"},
+			want: &RegexSelection{Nodes: []string{"a"}},
+		},
 	}
 	for _, tt := range tests {
 		got, err := NewSelection(tt.args.typename, tt.args.document)
@@ -71,3 +80,83 @@ func TestNewSelection(t *testing.T) {
 		}
 	}
 }
+
+func TestSelection_Type(t *testing.T) {
+	css, _ := NewCSS(DocumentTest)
+	xpath, _ := NewXpath(DocumentTest)
+	tests := []struct {
+		name      string
+		selection Selection
+		find      string
+		typename  string
+		selectors []string
+		attr      string
+	}{
+		{
+			name:      "test0",
+			selection: css,
+			find:      "book > author",
+			typename:  TypeXPATH,
+			selectors: []string{"", ".", "./name", ".//name", "//name", "/html/body", "/html/body/*", "//author/..", "@id", "//@id", "name(/*)"},
+			attr:      "id",
+		},
+		{
+			name:      "test1",
+			selection: xpath,
+			find:      "//character",
+			typename:  TypeCSS,
+			selectors: []string{"", "character", "name", "*", "character name", "body > character", "character:first-child", "[id], born", "[id!=x]", "html"},
+		},
+		{
+			name:      "test2",
+			selection: css,
+			find:      "quote, isbn",
+			typename:  TypeXPATH,
+			selectors: []string{"//quote", "//isbn/text()", "//*[2]", "//quote/preceding-sibling::*", "/html/head"},
+		},
+		{
+			name:      "test3",
+			selection: xpath,
+			find:      "//book",
+			typename:  TypeCSS,
+			selectors: []string{"#CMS", "name", "author > name", "character:nth-child(2)"},
+		},
+	}
+	for _, tt := range tests {
+		selection, _ := tt.selection.Find(tt.find)
+		got, err := selection.Type(tt.typename)
+		if err != nil {
+			t.Errorf("%q. Selection.Type() error = %v", tt.name, err)
+			continue
+		}
+		// the converted selection selects what the document parsed from the HTML of the selection selects
+		want, _ := NewSelection(tt.typename, selection.String())
+		for _, selector := range tt.selectors {
+			gotFound, err := got.Find(selector)
+			if err != nil {
+				t.Errorf("%q. Selection.Type().Find(%q) error = %v", tt.name, selector, err)
+				continue
+			}
+			wantFound, _ := want.Find(selector)
+			if gotFound.Text() != wantFound.Text() || gotFound.String() != wantFound.String() {
+				t.Errorf("%q. Selection.Type().Find(%q) = %q, want %q", tt.name, selector, gotFound.String(), wantFound.String())
+			}
+			gotAttr, _ := gotFound.Attr(tt.attr)
+			wantAttr, _ := wantFound.Attr(tt.attr)
+			if tt.attr != "" && gotAttr != wantAttr {
+				t.Errorf("%q. Selection.Type().Find(%q) attr = %q, want %q", tt.name, selector, gotAttr, wantAttr)
+			}
+		}
+		if got.Text() != want.Text() || got.String() != want.String() {
+			t.Errorf("%q. Selection.Type() = %q, want %q", tt.name, got.String(), want.String())
+		}
+	}
+	// the nodes selected after the conversion are the nodes of the document, which is not parsed again
+	authors, _ := css.Find("author")
+	converted, _ := authors.Type(TypeXPATH)
+	names, _ := converted.Find(".//name")
+	wantNames, _ := css.Find("author > name")
+	if got, want := names.(*XpathSelection).Nodes, wantNames.(*CSSSelection).Nodes.Nodes; !reflect.DeepEqual(got, want) || len(got) == 0 || got[0] != want[0] {
+		t.Errorf("Selection.Type().Find() nodes = %v, want %v", got, want)
+	}
+}
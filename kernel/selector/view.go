@@ -0,0 +1,479 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package selector
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+// view is the document which the HTML of the nodes of a selection is parsed into when the selection
+// is converted between CSS and XPATH, without parsing it: the nodes are the children of its body,
+// and its html element holds an empty head and the body.
+// The nodes are not copied, the selectors are applied to them as they are applied to the parsed document.
+type view struct {
+	nodes []*html.Node
+	// tops are the indexes of the nodes
+	tops map[*html.Node]int
+}
+
+// movedTags are the tags which are not kept at their places in the body when their HTML is parsed,
+// such as the cells of a table which are dropped outside the table, or the elements put into the head.
+var movedTags = map[string]bool{
+	"html": true, "head": true, "body": true, "frameset": true, "frame": true,
+	"caption": true, "col": true, "colgroup": true, "tbody": true, "td": true, "tfoot": true, "th": true, "thead": true, "tr": true,
+	"base": true, "basefont": true, "bgsound": true, "link": true, "meta": true, "noframes": true, "noscript": true,
+	"script": true, "style": true, "template": true, "title": true,
+}
+
+// newView returns the view of the nodes, it returns nil when the document parsed from their HTML
+// would not hold them as they are, so that the HTML has to be parsed.
+func newView(nodes []*html.Node) *view {
+	for _, node := range nodes {
+		if node.Type != html.ElementNode || movedTags[node.Data] {
+			return nil
+		}
+	}
+	conseq := &view{
+		nodes: nodes,
+		tops:  make(map[*html.Node]int, len(nodes)),
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		conseq.tops[nodes[i]] = i
+	}
+	return conseq
+}
+
+// locate returns the index of the node of the view which holds node,
+// and the indexes of the children from it down to node, it reports false when node is not in the view.
+func (v *view) locate(node *html.Node) (top int, path []int, ok bool) {
+	for current := node; current != nil; current = current.Parent {
+		if top, ok := v.tops[current]; ok {
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return top, path, true
+		}
+		index := 0
+		for sibling := current.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+			index++
+		}
+		path = append(path, index)
+	}
+	return 0, nil, false
+}
+
+// parsed returns the nodes of the document parsed from the HTML of the view which match the nodes in the view,
+// the nodes out of the view are returned as they are.
+func (v *view) parsed(nodes []*html.Node) []*html.Node {
+	document, err := html.Parse(strings.NewReader(v.html()))
+	if err != nil {
+		return nodes
+	}
+	var tops []*html.Node
+	if body := htmlquery.FindOne(document, "/html/body"); body != nil {
+		for child := body.FirstChild; child != nil; child = child.NextSibling {
+			tops = append(tops, child)
+		}
+	}
+	conseq := make([]*html.Node, 0, len(nodes))
+	for _, node := range nodes {
+		top, path, ok := v.locate(node)
+		if !ok {
+			conseq = append(conseq, node)
+			continue
+		}
+		if top >= len(tops) {
+			continue
+		}
+		current := tops[top]
+		for _, index := range path {
+			current = current.FirstChild
+			for i := 0; i < index && current != nil; i++ {
+				current = current.NextSibling
+			}
+			if current == nil {
+				break
+			}
+		}
+		if current != nil {
+			conseq = append(conseq, current)
+		}
+	}
+	return conseq
+}
+
+// html returns the HTML of the nodes, which is parsed when the view can not select the elements.
+func (v *view) html() string {
+	return output(func(writer io.Writer) error {
+		return renderNodes(writer, v.nodes)
+	})
+}
+
+// outputString writes the HTML of the document of the view to writer.
+func (v *view) outputString(writer io.Writer) error {
+	if _, err := io.WriteString(writer, "<html><head></head><body>"); err != nil {
+		return err
+	}
+	if err := renderNodes(writer, v.nodes); err != nil {
+		return err
+	}
+	_, err := io.WriteString(writer, "</body></html>")
+	return err
+}
+
+// outputText writes the text of the document of the view to writer.
+func (v *view) outputText(writer io.Writer) error {
+	return writeText(writer, v.nodes)
+}
+
+// navigator returns the navigator of the document of the view starting from node,
+// which is the document when node is nil. It reports false when node is not in the view.
+func (v *view) navigator(node *html.Node) (*viewNavigator, bool) {
+	conseq := &viewNavigator{view: v, kind: viewDocument, attr: -1}
+	if node != nil {
+		top, path, ok := v.locate(node)
+		if !ok {
+			return nil, false
+		}
+		conseq.kind, conseq.curr, conseq.top, conseq.depth = viewNode, node, top, len(path)
+	}
+	root := *conseq
+	conseq.root = &root
+	return conseq, true
+}
+
+// selectXpath selects the nodes matched by the expression from navigator in the document of the view,
+// it reports false when the expression selects the document, its html, head or body,
+// which are not made of the nodes of the view.
+func (v *view) selectXpath(navigator *viewNavigator, expr *xpath.Expr) (conseq []*html.Node, ok bool) {
+	iterator := expr.Select(navigator)
+	for iterator.MoveNext() {
+		navigator := iterator.Current().(*viewNavigator)
+		if navigator.kind != viewNode {
+			return nil, false
+		}
+		conseq = append(conseq, navigator.current())
+	}
+	return conseq, true
+}
+
+// selectCSS selects the elements matched by the selector from the document of the view,
+// it reports false when the selector may match the html, head or body of the document,
+// or may depend on the elements around the nodes of the view, such as "body > a" or "a:first-child".
+func (v *view) selectCSS(selector string, matcher cascadia.Selector) ([]*html.Node, bool) {
+	if !isElementSelector(selector) {
+		return nil, false
+	}
+	if matcher == nil {
+		compiled, err := cascadia.Compile(selector)
+		if err != nil {
+			return nil, false
+		}
+		matcher = compiled
+	}
+	var conseq []*html.Node
+	for _, node := range v.nodes {
+		if matcher.Match(node) {
+			conseq = append(conseq, node)
+		}
+		conseq = append(conseq, cascadia.QueryAll(node, matcher)...)
+	}
+	return conseq, true
+}
+
+// isElementSelector reports whether the CSS selector only depends on the element it matches,
+// and can not match an element without attributes, such as "a", "div.item" or "[href], b#id".
+func isElementSelector(selector string) bool {
+	for _, compound := range strings.Split(selector, ",") {
+		compound = strings.TrimSpace(compound)
+		// the attribute selectors are left out, the ones matching the elements without the attribute are not
+		outside := compound
+		for {
+			start, end := strings.Index(outside, "["), strings.Index(outside, "]")
+			if start < 0 || end < start {
+				break
+			}
+			outside = outside[:start] + "." + outside[end+1:]
+		}
+		if compound == "" || strings.ContainsAny(outside, " \t\n:>+~()[]|*\\\"'") || strings.Contains(compound, "!=") {
+			return false
+		}
+		// a class, an id or an attribute is never matched by the html, head or body of the document
+		if strings.ContainsAny(outside, ".#") {
+			continue
+		}
+		if tag := strings.ToLower(compound); tag == "html" || tag == "head" || tag == "body" {
+			return false
+		}
+	}
+	return true
+}
+
+// the kinds of the nodes of the document of a view
+const (
+	viewNode = iota
+	viewDocument
+	viewHTML
+	viewHead
+	viewBody
+)
+
+// viewNavigator walks the document of a view for the XPath expressions,
+// it is like htmlquery.NodeNavigator, but the nodes of the view are the children of the body.
+type viewNavigator struct {
+	view *view
+	// root is where the navigator starts from, as htmlquery starts from the node the expression is applied to.
+	root *viewNavigator
+	// kind is the kind of the current node, curr is the current node when it is a node of the view,
+	// which is at depth below the node of the view at top.
+	kind       int
+	curr       *html.Node
+	top, depth int
+	attr       int
+}
+
+// current returns the current node, an attribute is returned as htmlquery returns it.
+func (nav *viewNavigator) current() *html.Node {
+	if nav.attr == -1 {
+		return nav.curr
+	}
+	text := &html.Node{
+		Type: html.TextNode,
+		Data: nav.curr.Attr[nav.attr].Val,
+	}
+	return &html.Node{
+		Type:       html.ElementNode,
+		Data:       nav.curr.Attr[nav.attr].Key,
+		FirstChild: text,
+		LastChild:  text,
+	}
+}
+
+func (nav *viewNavigator) NodeType() xpath.NodeType {
+	switch nav.kind {
+	case viewDocument:
+		return xpath.RootNode
+	case viewHTML, viewHead, viewBody:
+		return xpath.ElementNode
+	}
+	switch nav.curr.Type {
+	case html.CommentNode:
+		return xpath.CommentNode
+	case html.TextNode:
+		return xpath.TextNode
+	case html.DocumentNode, html.DoctypeNode:
+		return xpath.RootNode
+	case html.ElementNode:
+		if nav.attr != -1 {
+			return xpath.AttributeNode
+		}
+		return xpath.ElementNode
+	}
+	panic(fmt.Sprintf("unknown HTML node type: %v", nav.curr.Type))
+}
+
+func (nav *viewNavigator) LocalName() string {
+	switch nav.kind {
+	case viewHTML:
+		return "html"
+	case viewHead:
+		return "head"
+	case viewBody:
+		return "body"
+	case viewDocument:
+		return ""
+	}
+	if nav.attr != -1 {
+		return nav.curr.Attr[nav.attr].Key
+	}
+	return nav.curr.Data
+}
+
+func (*viewNavigator) Prefix() string {
+	return ""
+}
+
+func (nav *viewNavigator) Value() string {
+	switch nav.kind {
+	case viewDocument:
+		return ""
+	case viewHTML, viewBody:
+		return output(nav.view.outputText)
+	case viewHead:
+		return ""
+	}
+	switch nav.curr.Type {
+	case html.CommentNode, html.TextNode:
+		return nav.curr.Data
+	case html.ElementNode:
+		if nav.attr != -1 {
+			return nav.curr.Attr[nav.attr].Val
+		}
+		return htmlquery.InnerText(nav.curr)
+	}
+	return ""
+}
+
+func (nav *viewNavigator) Copy() xpath.NodeNavigator {
+	conseq := *nav
+	return &conseq
+}
+
+func (nav *viewNavigator) MoveToRoot() {
+	root := nav.root
+	*nav = *root
+	nav.root = root
+}
+
+func (nav *viewNavigator) MoveToParent() bool {
+	switch {
+	case nav.attr != -1:
+		nav.attr = -1
+	case nav.kind == viewNode && nav.depth == 0:
+		nav.kind, nav.curr = viewBody, nil
+	case nav.kind == viewNode:
+		nav.curr, nav.depth = nav.curr.Parent, nav.depth-1
+	case nav.kind == viewHead || nav.kind == viewBody:
+		nav.kind = viewHTML
+	case nav.kind == viewHTML:
+		nav.kind = viewDocument
+	default:
+		return false
+	}
+	return true
+}
+
+func (nav *viewNavigator) MoveToNextAttribute() bool {
+	if nav.kind != viewNode || nav.attr >= len(nav.curr.Attr)-1 {
+		return false
+	}
+	nav.attr++
+	return true
+}
+
+func (nav *viewNavigator) MoveToChild() bool {
+	if nav.attr != -1 {
+		return false
+	}
+	switch nav.kind {
+	case viewDocument:
+		nav.kind = viewHTML
+	case viewHTML:
+		nav.kind = viewHead
+	case viewBody:
+		if len(nav.view.nodes) == 0 {
+			return false
+		}
+		nav.kind, nav.curr, nav.top, nav.depth = viewNode, nav.view.nodes[0], 0, 0
+	case viewNode:
+		if nav.curr.FirstChild == nil {
+			return false
+		}
+		nav.curr, nav.depth = nav.curr.FirstChild, nav.depth+1
+	default:
+		return false
+	}
+	return true
+}
+
+func (nav *viewNavigator) MoveToFirst() bool {
+	if nav.attr != -1 {
+		return false
+	}
+	switch {
+	case nav.kind == viewBody:
+		nav.kind = viewHead
+	case nav.kind == viewNode && nav.depth == 0:
+		if nav.top == 0 {
+			return false
+		}
+		nav.top = 0
+		nav.curr = nav.view.nodes[0]
+	case nav.kind == viewNode:
+		if nav.curr.PrevSibling == nil {
+			return false
+		}
+		for nav.curr.PrevSibling != nil {
+			nav.curr = nav.curr.PrevSibling
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (nav *viewNavigator) MoveToNext() bool {
+	if nav.attr != -1 {
+		return false
+	}
+	switch {
+	case nav.kind == viewHead:
+		nav.kind = viewBody
+	case nav.kind == viewNode && nav.depth == 0:
+		if nav.top+1 >= len(nav.view.nodes) {
+			return false
+		}
+		nav.top++
+		nav.curr = nav.view.nodes[nav.top]
+	case nav.kind == viewNode:
+		if nav.curr.NextSibling == nil {
+			return false
+		}
+		nav.curr = nav.curr.NextSibling
+	default:
+		return false
+	}
+	return true
+}
+
+func (nav *viewNavigator) MoveToPrevious() bool {
+	if nav.attr != -1 {
+		return false
+	}
+	switch {
+	case nav.kind == viewBody:
+		nav.kind = viewHead
+	case nav.kind == viewNode && nav.depth == 0:
+		if nav.top == 0 {
+			return false
+		}
+		nav.top--
+		nav.curr = nav.view.nodes[nav.top]
+	case nav.kind == viewNode:
+		if nav.curr.PrevSibling == nil {
+			return false
+		}
+		nav.curr = nav.curr.PrevSibling
+	default:
+		return false
+	}
+	return true
+}
+
+func (nav *viewNavigator) MoveTo(other xpath.NodeNavigator) bool {
+	node, ok := other.(*viewNavigator)
+	if !ok || node.view != nav.view {
+		return false
+	}
+	*nav = *node
+	return true
+}
@@ -17,9 +17,12 @@ package selector
 import (
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
 	"golang.org/x/net/html"
 )
 
@@ -27,12 +30,22 @@ import (
 type XpathSelection struct {
 	// Nodes stores the current element collection.
 	Nodes []*html.Node
+	// view is the document of the nodes of the CSS selection converted to the selection,
+	// the selection stands for the document instead of Nodes when it is not nil.
+	view *view
+	// within is the view which the nodes are selected from, the selectors applied to them walk its document.
+	within *view
 }
 
 // NewXpath is used to initialize a Xpath Selection from the string
 // It's a constructor function.
 func NewXpath(document string) (*XpathSelection, error) {
-	node, err := htmlquery.Parse(strings.NewReader(document))
+	return NewXpathReader(strings.NewReader(document))
+}
+
+// NewXpathReader is like NewXpath, but parses the document while reading it from reader.
+func NewXpathReader(reader io.Reader) (*XpathSelection, error) {
+	node, err := htmlquery.Parse(reader)
 	if err != nil {
 		return nil, err
 	}
@@ -53,6 +66,13 @@ func (selection *XpathSelection) Find(selector string) (_ Selection, err error)
 			err = fmt.Errorf("%s", e)
 		}
 	}()
+	if selector != "" && (selection.view != nil || selection.within != nil) {
+		expr, err := xpath.Compile(selector)
+		if err != nil {
+			return &XpathSelection{}, err
+		}
+		return selection.findView(selector, expr)
+	}
 	parents := selection.Nodes
 	var conseq []*html.Node
 	if selector != "" {
@@ -68,11 +88,82 @@ func (selection *XpathSelection) Find(selector string) (_ Selection, err error)
 	}, err
 }
 
+// FindQuery is like Find, but applies the compiled query.
+// It is a method of the QueryFinder implementation
+func (selection *XpathSelection) FindQuery(query *Query) (Selection, error) {
+	if query.Type != TypeXPATH || query.xpath == nil {
+		return selection.Find(query.Expr)
+	}
+	if selection.view != nil || selection.within != nil {
+		return selection.findView(query.Expr, query.xpath)
+	}
+	var conseq []*html.Node
+	for _, parent := range selection.Nodes {
+		conseq = append(conseq, htmlquery.QuerySelectorAll(parent, query.xpath)...)
+	}
+	return &XpathSelection{
+		Nodes: conseq,
+	}, nil
+}
+
+// findView selects the nodes matched by the expression from the document of the view,
+// or from the nodes selected from it. The HTML of the view is parsed
+// when the expression selects the nodes which are not in the view, such as its body.
+func (selection *XpathSelection) findView(selector string, expr *xpath.Expr) (Selection, error) {
+	v, starts := selection.view, []*html.Node{nil}
+	if v == nil {
+		v, starts = selection.within, selection.Nodes
+	}
+	var conseq []*html.Node
+	for _, node := range starts {
+		navigator, ok := v.navigator(node)
+		if !ok {
+			conseq = append(conseq, htmlquery.QuerySelectorAll(node, expr)...)
+			continue
+		}
+		nodes, ok := v.selectXpath(navigator, expr)
+		if !ok {
+			return selection.findParsed(selector)
+		}
+		conseq = append(conseq, nodes...)
+	}
+	return &XpathSelection{
+		Nodes:  conseq,
+		within: v,
+	}, nil
+}
+
+// findParsed is like Find, but applies the selector to the document parsed from the HTML of the view.
+func (selection *XpathSelection) findParsed(selector string) (Selection, error) {
+	if selection.view == nil {
+		return (&XpathSelection{Nodes: selection.within.parsed(selection.Nodes)}).Find(selector)
+	}
+	document, err := NewXpath(selection.view.html())
+	if err != nil {
+		return nil, err
+	}
+	return document.Find(selector)
+}
+
 // Type method is used to convert the current Selection to other types.
+// The CSS selection selects from the same nodes as it selects from the document parsed from their HTML,
+// the document is not parsed again unless its nodes would be moved by the parser, see view.
 // It's a standard method of the selection implementation
 func (selection *XpathSelection) Type(typename string) (Selection, error) {
-	if typename == TypeXPATH {
+	switch typename {
+	case TypeXPATH:
 		return selection, nil
+	case TypeCSS:
+		if selection.view != nil {
+			return &CSSSelection{Nodes: &goquery.Selection{}, view: selection.view}, nil
+		}
+		if len(selection.Nodes) == 1 && selection.Nodes[0].Type == html.DocumentNode {
+			document := selection.Nodes[0]
+			return &CSSSelection{Nodes: goquery.NewDocumentFromNode(document).Contents(), document: document}, nil
+		}
+		if view := newView(selection.Nodes); view != nil {
+			return &CSSSelection{Nodes: &goquery.Selection{}, view: view}, nil
+		}
 	}
 	return NewSelection(typename, selection.String())
 }
@@ -84,12 +175,20 @@ func (selection *XpathSelection) Eq(index int) (Selection, error) {
 	if index < 0 {
 		return nil, errors.New("method Eq received less than 0 parameters")
 	}
+	if selection.view != nil {
+		// the document is the only element of the selection
+		if index == 0 {
+			return selection, nil
+		}
+		return nil, nil
+	}
 	nodes := selection.Nodes
 	if y := len(nodes); y > 0 && index < y {
 		return &XpathSelection{
 			Nodes: []*html.Node{
 				nodes[index],
 			},
+			within: selection.within,
 		}, nil
 	}
 	return nil, nil
@@ -98,11 +197,16 @@ func (selection *XpathSelection) Eq(index int) (Selection, error) {
 // Each is used to traverse the current elements
 // It's a standard method of the selection implementation
 func (selection *XpathSelection) Each(iterator func(int, Selection) bool) error {
+	if selection.view != nil {
+		iterator(0, selection)
+		return nil
+	}
 	for i := 0; i < len(selection.Nodes); i++ {
 		if !iterator(i, &XpathSelection{
 			Nodes: []*html.Node{
 				selection.Nodes[i],
 			},
+			within: selection.within,
 		}) {
 			break
 		}
@@ -113,6 +217,7 @@ func (selection *XpathSelection) Each(iterator func(int, Selection) bool) error
 // Attr is used to obtain values of specified attributes of an element
 // It's a standard method of the selection implementation
 func (selection *XpathSelection) Attr(attr string) (conseq string, err error) {
+	// the document of a view has no attributes
 	if len(selection.Nodes) == 0 {
 		return
 	}
@@ -122,19 +227,29 @@ func (selection *XpathSelection) Attr(attr string) (conseq string, err error) {
 // String method is used to return the string of all elements in the current element collection
 // the html/xml tag in this text will not be deleted
 // It's a standard method of the selection implementation
-func (selection *XpathSelection) String() (document string) {
-	for _, node := range selection.Nodes {
-		document += htmlquery.OutputHTML(node, true)
-	}
-	return
+func (selection *XpathSelection) String() string {
+	return output(selection.OutputString)
 }
 
 // Text method is used to return the text of all elements in the current element collection
 // the text will not contain html/xml tags and attributes
 // It's a standard method of the selection implementation
-func (selection *XpathSelection) Text() (document string) {
-	for _, node := range selection.Nodes {
-		document += htmlquery.InnerText(node)
+func (selection *XpathSelection) Text() string {
+	return output(selection.OutputText)
+}
+
+// OutputString writes the String of the selection to writer, see OutputWriter.
+func (selection *XpathSelection) OutputString(writer io.Writer) error {
+	if selection.view != nil {
+		return selection.view.outputString(writer)
+	}
+	return renderNodes(writer, selection.Nodes)
+}
+
+// OutputText writes the Text of the selection to writer, see OutputWriter.
+func (selection *XpathSelection) OutputText(writer io.Writer) error {
+	if selection.view != nil {
+		return selection.view.outputText(writer)
 	}
-	return
+	return writeText(writer, selection.Nodes)
 }
@@ -0,0 +1,112 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/storyicon/graphquery/kernel/selector"
+)
+
+const (
+	// ErrStreamPath means the path to stream does not refer to an array node
+	ErrStreamPath = "can not stream %q, it is not the path of an array node"
+	// ErrStreamStopped means the parse is stopped by the callback of the stream
+	ErrStreamStopped = "stream stopped: %s"
+)
+
+// stream is the array node whose elements are emitted to the callback as soon as they are parsed.
+type stream struct {
+	node *GraphNode
+	emit func(item GraphRawData) error
+	// err is the error returned by emit, which stops the parse.
+	err error
+}
+
+// Stream is like Parse, but emits every element of the array node at path to emit as soon as it is parsed,
+// instead of keeping it in the output, such as the rows of a listing page.
+// path is made of the keys of the nodes from the user node to the array node, such as []string{"page", "items"},
+// so that a key can contain any characters, such as "meta.items". The elements of all the instances of the node are emitted when it is nested in another array node.
+// emit is called on the goroutine of the parse, so the next element is not parsed before it returns.
+// The parse stops when emit returns an error, which is returned by Stream.
+// The array node is left empty in the data of the response. The elements are filtered,
+// and the elements of a sorted or reversed node are emitted after all of them are parsed.
+func (graph *Graph) Stream(document string, path []string, emit func(item GraphRawData) error, options ...Option) (*GraphResponse, error) {
+	return graph.StreamContext(context.Background(), document, path, emit, options...)
+}
+
+// StreamContext is like Stream, but stops parsing when ctx is cancelled or expired.
+func (graph *Graph) StreamContext(ctx context.Context, document string, path []string, emit func(item GraphRawData) error, options ...Option) (*GraphResponse, error) {
+	node := graph.lookup(path)
+	if node == nil || node.NodeType != TypeArray && node.NodeType != TypeObjectArray {
+		return nil, fmt.Errorf(ErrStreamPath, path)
+	}
+	conseq := &stream{
+		node: node,
+		emit: emit,
+	}
+	selection, _ := selector.NewString(document)
+	options = append([]Option{func(exec *execution) {
+		exec.stream = conseq
+	}}, options...)
+	return graph.parseSelection(ctx, selection, options...), conseq.err
+}
+
+// lookup returns the node at path, which is made of the keys of the nodes.
+func (graph *Graph) lookup(path []string) *GraphNode {
+	nodes := graph.Nodes
+	var conseq *GraphNode
+	for _, key := range path {
+		conseq = nil
+		for _, node := range nodes {
+			if node.Key() == key {
+				conseq = node
+				break
+			}
+		}
+		if conseq == nil {
+			return nil
+		}
+		nodes = conseq.Children
+	}
+	return conseq
+}
+
+// streams reports whether the elements of node are emitted to the stream of the execution.
+func (exec *execution) streams(node *GraphNode) bool {
+	return exec.stream != nil && exec.stream.node == node
+}
+
+// emit emits the element of the array node made of the values of its children,
+// it reports false when the stream is stopped by the callback.
+func (s *scope) emit(values []*GraphData) bool {
+	element := NewGraphData(s.node.Key(), s.node.NodeType)
+	for j, value := range values {
+		if err := element.Push(0, s.node.Children[j].Key(), value); err != nil {
+			s.addError(err)
+			return false
+		}
+	}
+	items, _ := element.Output().([]GraphRawData)
+	for _, item := range items {
+		if err := s.exec.stream.emit(item); err != nil {
+			s.exec.stream.err = err
+			s.exec.stop(fmt.Sprintf(ErrStreamStopped, err))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/storyicon/graphquery/kernel/pipeline"
+)
+
+// segment is a part of the argument of a pipeline, which is a literal text or a variable such as {$title}.
+type segment struct {
+	text     string
+	variable bool
+}
+
+// parseTemplate splits str into the literal texts and the variables in it,
+// it returns nil when there is no variable in str.
+func parseTemplate(str string) (segments []segment) {
+	for {
+		start := strings.Index(str, "{$")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(str[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		if start > 0 {
+			segments = append(segments, segment{text: str[:start]})
+		}
+		segments = append(segments, segment{text: str[start+len("{$") : end], variable: true})
+		str = str[end+1:]
+	}
+	if segments != nil && str != "" {
+		segments = append(segments, segment{text: str})
+	}
+	return
+}
+
+// Bind binds the pipelines of the graph to its registry, see pipeline.Registry.Bind,
+// caches the templates in the arguments of them, such as "{$title}: {$}",
+// and compiles the regular expressions of the filters.
+// The graphs compiled by the compiler are bound, Bind should be called again after the Registry of the graph
+// is changed or after the graph is loaded by LoadGraph, and it should not be called while the graph is being parsed.
+func (graph *Graph) Bind() (err error) {
+	registry := graph.registry()
+	templates, patterns := map[string][]segment{}, map[string]*regexp.Regexp{}
+	var bind func(pipelines pipeline.Pipelines, node *GraphNode)
+	bind = func(pipelines pipeline.Pipelines, node *GraphNode) {
+		for _, pipe := range pipelines {
+			if e := registry.Bind(pipe); e != nil && err == nil {
+				err = fmt.Errorf("%s: %s", node.Name, e)
+			}
+			for _, arg := range pipe.Args {
+				if segments := parseTemplate(arg); segments != nil {
+					templates[arg] = segments
+				}
+			}
+			for _, expr := range pipe.Exprs {
+				bind(expr, node)
+			}
+		}
+	}
+	for _, node := range append(append([]*GraphNode{}, graph.Fragments...), graph.Nodes...) {
+		node.traverse(func(node *GraphNode) bool {
+			bind(node.Pipelines, node)
+			if node.Filter != nil {
+				if e := compilePatterns(node.Filter, patterns); e != nil && err == nil {
+					err = fmt.Errorf("%s: %s", node.Name, e)
+				}
+			}
+			return true
+		})
+	}
+	graph.templates, graph.patterns = templates, patterns
+	return
+}
+
+// template returns the segments of str, which are cached by Bind.
+func (graph *Graph) template(str string) []segment {
+	if segments, exists := graph.templates[str]; exists {
+		return segments
+	}
+	if graph.templates != nil && !strings.Contains(str, "{$") {
+		return nil
+	}
+	return parseTemplate(str)
+}
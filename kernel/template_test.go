@@ -0,0 +1,75 @@
+//    Copyright 2018 storyicon@foxmail.com
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kernel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want []segment
+	}{
+		{
+			name: "test0",
+			str:  "title",
+			want: nil,
+		},
+		{
+			name: "test1",
+			str:  "{$}",
+			want: []segment{{variable: true}},
+		},
+		{
+			name: "test2",
+			str:  "[{$title}: {$}] {$",
+			want: []segment{{text: "["}, {text: "title", variable: true}, {text: ": "}, {variable: true}, {text: "] {$"}},
+		},
+		{
+			name: "test3",
+			str:  "{{$a}}{$b",
+			want: []segment{{text: "{"}, {text: "a", variable: true}, {text: "}{$b"}},
+		},
+	}
+	for _, tt := range tests {
+		if got := parseTemplate(tt.str); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q. parseTemplate() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGraph_Bind(t *testing.T) {
+	match := func(pattern string) *Predicate {
+		return &Predicate{Op: OpMatch, Operands: []*Predicate{
+			{Op: OperandChild, Value: "b"},
+			{Op: OperandString, Value: pattern},
+		}}
+	}
+	graph := &Graph{
+		Nodes: []*GraphNode{
+			{Name: "a", NodeType: TypeArray, Filter: &Predicate{Op: OpNot, Operands: []*Predicate{match("^x")}}},
+		},
+	}
+	if err := graph.Bind(); err != nil || graph.patterns["^x"] == nil {
+		t.Errorf("Graph.Bind() = %v, patterns = %v, want the pattern compiled", err, graph.patterns)
+	}
+	graph.Nodes[0].Filter = match("(x")
+	if err := graph.Bind(); err == nil {
+		t.Errorf("Graph.Bind() error = nil, want the error of the pattern")
+	}
+}